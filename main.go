@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
 	p "github.com/daytonaio/daytona-provider-windows/pkg/provider"
 	"github.com/daytonaio/daytona/pkg/provider"
@@ -16,11 +18,25 @@ func main() {
 		Output:     os.Stderr,
 		JSONFormat: true,
 	})
+
+	windowsProvider := &p.WindowsProvider{}
+
+	// Tear down the SSH tunnels when the plugin is terminated
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		windowsProvider.Close()
+		os.Exit(0)
+	}()
+
 	hc_plugin.Serve(&hc_plugin.ServeConfig{
 		HandshakeConfig: providermanager.ProviderHandshakeConfig,
 		Plugins: map[string]hc_plugin.Plugin{
-			"windows-provider": &provider.ProviderPlugin{Impl: &p.WindowsProvider{}},
+			"windows-provider": &provider.ProviderPlugin{Impl: windowsProvider},
 		},
 		Logger: logger,
 	})
+
+	windowsProvider.Close()
 }
@@ -1,27 +1,32 @@
 package client
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 
-	"github.com/daytonaio/daytona-provider-windows/pkg/ssh_tunnel/util"
 	"github.com/daytonaio/daytona-provider-windows/pkg/types"
 
 	"github.com/docker/docker/client"
-
-	log "github.com/sirupsen/logrus"
 )
 
-func GetClient(targetOptions types.TargetConfigOptions, sockDir string) (*client.Client, error) {
+// GetClient returns a Docker client for the target. The returned release function, if not nil, must be
+// called once the client is closed to release the SSH tunnel it goes through.
+func GetClient(targetOptions types.TargetConfigOptions, tunnelManager *TunnelManager) (*client.Client, func(), error) {
+	if targetOptions.DockerHost != nil && *targetOptions.DockerHost != "" {
+		cli, err := getHostClient(targetOptions)
+		return cli, nil, err
+	}
+
 	if targetOptions.RemoteHostname == nil {
-		return getLocalClient(targetOptions)
+		cli, err := getLocalClient(targetOptions)
+		return cli, nil, err
 	}
 
-	return getRemoteClient(targetOptions, sockDir)
+	return getRemoteClient(targetOptions, tunnelManager)
 }
 
 func getLocalClient(targetOptions types.TargetConfigOptions) (*client.Client, error) {
@@ -39,6 +44,10 @@ func getLocalClient(targetOptions types.TargetConfigOptions) (*client.Client, er
 		return cli, nil
 	}
 
+	if dockerHost := os.Getenv(client.EnvOverrideHost); strings.HasPrefix(dockerHost, "ssh://") {
+		return getSshHostClient(dockerHost)
+	}
+
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, err
@@ -47,56 +56,74 @@ func getLocalClient(targetOptions types.TargetConfigOptions) (*client.Client, er
 	return cli, nil
 }
 
-func getRemoteClient(targetOptions types.TargetConfigOptions, sockDir string) (*client.Client, error) {
-	localSockPath, err := forwardDockerSock(targetOptions, sockDir)
+// getHostClient connects to the Docker Host URL directly, using mutual TLS if certificates are set
+func getHostClient(targetOptions types.TargetConfigOptions) (*client.Client, error) {
+	if strings.HasPrefix(*targetOptions.DockerHost, "ssh://") {
+		return getSshHostClient(*targetOptions.DockerHost)
+	}
+
+	opts := []client.Opt{client.WithHost(*targetOptions.DockerHost), client.WithAPIVersionNegotiation()}
+
+	caPath, err := getOptionalPath(targetOptions.TlsCaPath)
 	if err != nil {
 		return nil, err
 	}
-
-	cli, err := client.NewClientWithOpts(client.WithHost(fmt.Sprintf("unix://%s", localSockPath)), client.WithAPIVersionNegotiation())
+	certPath, err := getOptionalPath(targetOptions.TlsCertPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPath, err := getOptionalPath(targetOptions.TlsKeyPath)
 	if err != nil {
 		return nil, err
 	}
 
+	if caPath != "" || certPath != "" || keyPath != "" {
+		if (certPath == "") != (keyPath == "") {
+			return nil, errors.New("TLS Cert Path and TLS Key Path must be set together")
+		}
+		opts = append(opts, client.WithTLSClientConfig(caPath, certPath, keyPath))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client for %s: %w", *targetOptions.DockerHost, err)
+	}
+
 	return cli, nil
 }
 
-func forwardDockerSock(targetOptions types.TargetConfigOptions, sockDir string) (string, error) {
-	localSockPath := path.Join(sockDir, fmt.Sprintf("daytona-%s-docker.sock", strings.ReplaceAll(*targetOptions.RemoteHostname, ".", "-")))
-
-	if _, err := os.Stat(path.Dir(localSockPath)); err != nil {
-		err := os.MkdirAll(path.Dir(localSockPath), 0755)
-		if err != nil {
-			return "", err
-		}
+func getOptionalPath(p *string) (string, error) {
+	if p == nil || *p == "" {
+		return "", nil
 	}
 
-	if _, err := os.Stat(localSockPath); err == nil {
-		return localSockPath, nil
+	if !strings.HasPrefix(*p, "~/") {
+		return *p, nil
 	}
 
-	remoteSockPath := "/var/run/docker.sock"
-	if targetOptions.SockPath != nil && *targetOptions.SockPath != "" {
-		remoteSockPath = *targetOptions.SockPath
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
 	}
 
-	startedChan, errChan := util.ForwardRemoteUnixSock(
-		context.Background(),
-		targetOptions,
-		localSockPath,
-		remoteSockPath,
-	)
+	return filepath.Join(homeDir, (*p)[2:]), nil
+}
 
-	go func() {
-		err := <-errChan
-		if err != nil {
-			log.Error(err)
-			startedChan <- false
-			os.Remove(localSockPath)
-		}
-	}()
+func getRemoteClient(targetOptions types.TargetConfigOptions, tunnelManager *TunnelManager) (*client.Client, func(), error) {
+	if tunnelManager == nil {
+		return nil, nil, errors.New("tunnel manager not set. Did you forget to call Initialize?")
+	}
+
+	localSockPath, release, err := tunnelManager.Acquire(targetOptions)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	<-startedChan
+	cli, err := client.NewClientWithOpts(client.WithHost(fmt.Sprintf("unix://%s", localSockPath)), client.WithAPIVersionNegotiation())
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
 
-	return localSockPath, nil
+	return cli, release, nil
 }
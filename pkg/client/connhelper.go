@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// getSshHostClient reaches the Docker daemon of an ssh:// host the way the Docker CLI connection helper does,
+// by running `docker system dial-stdio` on the host through the ssh binary. The user's SSH config and agent apply.
+func getSshHostClient(dockerHost string) (*client.Client, error) {
+	u, err := url.Parse(dockerHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %s: %w", dockerHost, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid Docker host %s: host is required", dockerHost)
+	}
+
+	args := []string{"-o", "ConnectTimeout=30"}
+	if u.User != nil && u.User.Username() != "" {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", u.Hostname(), "docker")
+	if u.Path != "" && u.Path != "/" {
+		args = append(args, "--host", "unix://"+u.Path)
+	}
+	args = append(args, "system", "dial-stdio")
+
+	cli, err := client.NewClientWithOpts(
+		// The host is only used for the HTTP requests, connections are made by the dialer
+		client.WithHost("http://docker.example.com"),
+		client.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return newCommandConn("ssh", args...)
+		}),
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client for %s: %w", dockerHost, err)
+	}
+
+	return cli, nil
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a command. The pipes are os.Files so deadlines
+// are supported.
+type commandConn struct {
+	cmd       *exec.Cmd
+	stdin     *os.File
+	stdout    *os.File
+	stderr    lockedBuffer
+	closeOnce sync.Once
+}
+
+func newCommandConn(name string, args ...string) (net.Conn, error) {
+	c := &commandConn{
+		cmd: exec.Command(name, args...),
+	}
+	c.cmd.Stderr = &c.stderr
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		stdinReader.Close()
+		stdinWriter.Close()
+		return nil, err
+	}
+	c.cmd.Stdin = stdinReader
+	c.cmd.Stdout = stdoutWriter
+	c.stdin = stdinWriter
+	c.stdout = stdoutReader
+
+	err = c.cmd.Start()
+
+	// The command has its own copies of its ends of the pipes
+	stdinReader.Close()
+	stdoutWriter.Close()
+
+	if err != nil {
+		c.stdin.Close()
+		c.stdout.Close()
+		return nil, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+
+	return c, nil
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err != nil && err != io.EOF && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, fmt.Errorf("%w (%s)", err, strings.TrimSpace(c.stderr.String()))
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// CloseWrite is used by the Docker client to half-close hijacked connections
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.cmd.Wait()
+		c.stdout.Close()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return commandAddr{}
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return commandAddr{}
+}
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	err := c.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+
+	return c.SetWriteDeadline(t)
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return c.stdout.SetReadDeadline(t)
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return c.stdin.SetWriteDeadline(t)
+}
+
+// lockedBuffer is a bytes.Buffer safe to write from the command and read from the connection concurrently
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.String()
+}
+
+type commandAddr struct{}
+
+func (commandAddr) Network() string {
+	return "command"
+}
+
+func (commandAddr) String() string {
+	return "command"
+}
@@ -0,0 +1,392 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-windows/pkg/jump_hosts"
+	"github.com/daytonaio/daytona-provider-windows/pkg/known_hosts"
+	"github.com/daytonaio/daytona-provider-windows/pkg/ssh_tunnel"
+	"github.com/daytonaio/daytona-provider-windows/pkg/ssh_tunnel/util"
+	"github.com/daytonaio/daytona-provider-windows/pkg/types"
+	"github.com/docker/docker/client"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sockHealthCheckTimeout = 10 * time.Second
+	tunnelStopTimeout      = 10 * time.Second
+	tunnelIdleTimeout      = 5 * time.Minute
+)
+
+// TunnelManager keeps a single SSH tunnel to the Docker socket of each remote host and user.
+// Tunnels are shared by all Docker clients of that host and stopped once they have not been used for tunnelIdleTimeout.
+type TunnelManager struct {
+	sockDir        string
+	knownHostsPath string
+	mutex          sync.Mutex
+	tunnels        map[string]*tunnelEntry
+	closed         bool
+}
+
+// TunnelInfo describes the state of a tunnel managed by a TunnelManager
+type TunnelInfo struct {
+	Host          string
+	User          string
+	LocalSockPath string
+	State         ssh_tunnel.ConnectionState
+	LastError     error
+	References    int
+}
+
+// tunnelEntry holds the tunnel of a host. Its mutex serializes health checks and (re)starts of the tunnel
+// without blocking the tunnels of other hosts.
+type tunnelEntry struct {
+	mutex sync.Mutex
+
+	// Written with both mutexes held, so the state of the tunnel can be listed while it is (re)started
+	tunnel *tunnel
+
+	// Guarded by the mutex of the TunnelManager
+	references int
+	idleTimer  *time.Timer
+}
+
+type tunnel struct {
+	host          string
+	user          string
+	localSockPath string
+	cancel        context.CancelFunc
+	stopped       chan struct{}
+
+	mutex     sync.Mutex
+	state     ssh_tunnel.ConnectionState
+	lastError error
+}
+
+func NewTunnelManager(sockDir string, knownHostsPath string) *TunnelManager {
+	return &TunnelManager{
+		sockDir:        sockDir,
+		knownHostsPath: knownHostsPath,
+		tunnels:        map[string]*tunnelEntry{},
+	}
+}
+
+// Acquire returns the local socket forwarded to the Docker socket of the remote host, starting the tunnel if needed.
+// The returned function must be called once the socket is no longer used.
+func (m *TunnelManager) Acquire(targetOptions types.TargetConfigOptions) (string, func(), error) {
+	if targetOptions.RemoteHostname == nil {
+		return "", nil, errors.New("Remote Hostname is required")
+	}
+
+	key := getTunnelKey(targetOptions)
+
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return "", nil, errors.New("tunnel manager is closed")
+	}
+
+	e, ok := m.tunnels[key]
+	if !ok {
+		e = &tunnelEntry{}
+		m.tunnels[key] = e
+	}
+	e.references++
+	if e.idleTimer != nil {
+		e.idleTimer.Stop()
+		e.idleTimer = nil
+	}
+	m.mutex.Unlock()
+
+	localSockPath, err := m.connect(key, e, targetOptions)
+	if err != nil {
+		m.release(key, e)
+		return "", nil, err
+	}
+
+	var once sync.Once
+	return localSockPath, func() {
+		once.Do(func() {
+			m.release(key, e)
+		})
+	}, nil
+}
+
+// Tunnels returns the state of all tunnels currently managed. Stopped tunnels are listed until their host is used
+// again or the manager is closed.
+func (m *TunnelManager) Tunnels() []TunnelInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tunnels := []TunnelInfo{}
+	for _, e := range m.tunnels {
+		if e.tunnel == nil {
+			continue
+		}
+
+		tunnels = append(tunnels, TunnelInfo{
+			Host:          e.tunnel.host,
+			User:          e.tunnel.user,
+			LocalSockPath: e.tunnel.localSockPath,
+			State:         e.tunnel.getState(),
+			LastError:     e.tunnel.getLastError(),
+			References:    e.references,
+		})
+	}
+
+	return tunnels
+}
+
+// Close stops all tunnels. The manager can't be used afterwards.
+func (m *TunnelManager) Close() {
+	m.mutex.Lock()
+	m.closed = true
+	entries := m.tunnels
+	m.tunnels = map[string]*tunnelEntry{}
+	for _, e := range entries {
+		if e.idleTimer != nil {
+			e.idleTimer.Stop()
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, e := range entries {
+		e.mutex.Lock()
+		e.stopTunnel()
+		e.mutex.Unlock()
+	}
+}
+
+// connect returns the local socket of the tunnel of e, (re)starting the tunnel if it is not running or the Docker
+// socket does not respond.
+func (m *TunnelManager) connect(key string, e *tunnelEntry, targetOptions types.TargetConfigOptions) (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if m.isClosed() {
+		return "", errors.New("tunnel manager is closed")
+	}
+
+	if e.tunnel != nil {
+		if e.tunnel.getState() == ssh_tunnel.StateStarted {
+			if isDockerSockAlive(e.tunnel.localSockPath) {
+				return e.tunnel.localSockPath, nil
+			}
+
+			// Clients of the replaced tunnel use the same socket path and are served by the new one
+			log.Warnf("Docker socket %s is not responding, recreating the SSH tunnel", e.tunnel.localSockPath)
+		}
+		e.stopTunnel()
+	}
+
+	t, err := m.startTunnel(key, e, targetOptions)
+	if err != nil {
+		return "", err
+	}
+
+	return t.localSockPath, nil
+}
+
+func (m *TunnelManager) release(key string, e *tunnelEntry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	e.references--
+	if e.references > 0 || m.closed {
+		return
+	}
+
+	// Docker clients are created for every provider call, the tunnel is kept open for the next one
+	e.idleTimer = time.AfterFunc(tunnelIdleTimeout, func() {
+		m.stopIdleTunnel(key, e)
+	})
+}
+
+func (m *TunnelManager) stopIdleTunnel(key string, e *tunnelEntry) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	m.mutex.Lock()
+	idle := e.references == 0
+	m.mutex.Unlock()
+
+	if idle && e.tunnel != nil && e.tunnel.getState() != ssh_tunnel.StateStopped {
+		log.Debugf("Stopping idle SSH tunnel to %s", key)
+		e.stopTunnel()
+	}
+}
+
+func (m *TunnelManager) isClosed() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.closed
+}
+
+// startTunnel starts the tunnel of e, which must be called with the mutex of e held. The tunnel is set on e even
+// if it fails to start, so its error is listed by Tunnels.
+func (m *TunnelManager) startTunnel(key string, e *tunnelEntry, targetOptions types.TargetConfigOptions) (*tunnel, error) {
+	err := os.MkdirAll(m.sockDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	localSockPath := path.Join(m.sockDir, fmt.Sprintf("daytona-%s-docker.sock", strings.NewReplacer(".", "-", "@", "-", ":", "-").Replace(key)))
+
+	// A socket left behind by a previous plugin process can't be listened on
+	err = os.Remove(localSockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale Docker socket %s: %w", localSockPath, err)
+	}
+
+	remoteSockPath := "/var/run/docker.sock"
+	if targetOptions.SockPath != nil && *targetOptions.SockPath != "" {
+		remoteSockPath = *targetOptions.SockPath
+	}
+
+	sshTun, err := util.NewRemoteUnixSockTunnel(targetOptions, m.knownHostsPath, localSockPath, remoteSockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := jump_hosts.NewDialer(targetOptions.JumpHosts, known_hosts.HostKeyCallback(m.knownHostsPath, targetOptions.KnownHostsFile))
+	if err != nil {
+		return nil, err
+	}
+	sshTun.SetDialFunc(dialer.Dial)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &tunnel{
+		host:          *targetOptions.RemoteHostname,
+		user:          getTunnelUser(targetOptions),
+		localSockPath: localSockPath,
+		cancel:        cancel,
+		stopped:       make(chan struct{}),
+		state:         ssh_tunnel.StateStarting,
+	}
+
+	m.mutex.Lock()
+	e.tunnel = t
+	m.mutex.Unlock()
+
+	started := make(chan struct{}, 1)
+
+	sshTun.SetConnState(func(tun *ssh_tunnel.SshTunnel, state ssh_tunnel.ConnectionState) {
+		log.Debugf("SSH tunnel to %s is %s", key, state)
+		t.setState(state)
+		if state == ssh_tunnel.StateStarted {
+			started <- struct{}{}
+		}
+	})
+
+	sshTun.SetTunneledConnState(func(tun *ssh_tunnel.SshTunnel, state *ssh_tunnel.TunneledConnectionState) {
+		log.Debugf("%+v", state)
+		if state.Error != nil {
+			t.setLastError(state.Error)
+		}
+	})
+
+	go func() {
+		defer close(t.stopped)
+
+		err := sshTun.Start(ctx)
+		if err != nil {
+			log.Error(err)
+			t.setLastError(err)
+		}
+	}()
+
+	select {
+	case <-started:
+		return t, nil
+	case <-t.stopped:
+		return nil, fmt.Errorf("failed to forward Docker socket from %s: %w", t.host, t.getLastError())
+	}
+}
+
+// stopTunnel must be called with the mutex of e held. The stopped tunnel is kept, so its state can be listed.
+func (e *tunnelEntry) stopTunnel() {
+	if e.tunnel == nil {
+		return
+	}
+
+	e.tunnel.stop()
+}
+
+func (t *tunnel) stop() {
+	t.cancel()
+
+	select {
+	case <-t.stopped:
+	case <-time.After(tunnelStopTimeout):
+		log.Warnf("SSH tunnel to %s did not stop in time", t.host)
+	}
+}
+
+func (t *tunnel) setState(state ssh_tunnel.ConnectionState) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state = state
+}
+
+func (t *tunnel) getState() ssh_tunnel.ConnectionState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.state
+}
+
+func (t *tunnel) setLastError(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.lastError = err
+}
+
+func (t *tunnel) getLastError() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.lastError
+}
+
+func getTunnelUser(targetOptions types.TargetConfigOptions) string {
+	if targetOptions.RemoteUser != nil && *targetOptions.RemoteUser != "" {
+		return *targetOptions.RemoteUser
+	}
+
+	return "root"
+}
+
+func getTunnelKey(targetOptions types.TargetConfigOptions) string {
+	port := 22
+	if targetOptions.RemotePort != nil {
+		port = *targetOptions.RemotePort
+	}
+
+	return fmt.Sprintf("%s@%s:%d", getTunnelUser(targetOptions), *targetOptions.RemoteHostname, port)
+}
+
+// isDockerSockAlive checks whether the Docker daemon responds through the forwarded socket
+func isDockerSockAlive(sockPath string) bool {
+	cli, err := client.NewClientWithOpts(client.WithHost(fmt.Sprintf("unix://%s", sockPath)), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return false
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sockHealthCheckTimeout)
+	defer cancel()
+
+	_, err = cli.Ping(ctx)
+	return err == nil
+}
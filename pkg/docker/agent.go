@@ -0,0 +1,143 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/daytonaio/daytona-provider-windows/pkg/windows_quote"
+	"github.com/daytonaio/daytona/pkg/models"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	vmHomeDir        = "C:\\Users\\daytona"
+	vmAgentDir       = vmHomeDir + "\\.daytona"
+	vmAgentLogFile   = vmHomeDir + "\\.daytona-agent.log"
+	agentTaskName    = "RunDaytonaAgent"
+	agentScriptName  = "agent.cmd"
+	agentVersionFile = "version"
+)
+
+// installDaytonaAgent installs the Daytona agent matching the server version into the VM, writes its configuration
+// and (re)starts it. The binary is only downloaded if the installed version differs from the server version.
+func (d *DockerClient) installDaytonaAgent(workspace *models.Workspace, workspaceDir, daytonaDownloadUrl string, logWriter io.Writer, sshClient *ssh.Client) error {
+	if daytonaDownloadUrl == "" {
+		return errors.New("Daytona download URL not set")
+	}
+
+	// The agent has to match the server, there is no version to fall back to
+	version := d.daytonaVersion
+	if version == "" {
+		return errors.New("Daytona version not set, can't determine the agent version to install")
+	}
+
+	// The download URL points to the install script served by the Daytona server, the binaries are served next to it
+	binaryBaseUrl, err := url.JoinPath(strings.TrimSuffix(daytonaDownloadUrl, "/script"), version)
+	if err != nil {
+		return fmt.Errorf("failed to parse Daytona download URL: %w", err)
+	}
+
+	agentEnv, err := getAgentEnv(workspace, workspaceDir)
+	if err != nil {
+		return err
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Installing Daytona agent %s...\n", version)))
+
+	script, err := getAgentInstallScript(binaryBaseUrl, version, workspace.ApiKey, agentEnv)
+	if err != nil {
+		return err
+	}
+
+	err = d.executePowerShell(script, logWriter, sshClient)
+	if err != nil {
+		return fmt.Errorf("failed to install Daytona agent: %w", err)
+	}
+
+	logWriter.Write([]byte("Daytona agent installed\n"))
+
+	return nil
+}
+
+// getAgentEnv returns the environment the agent is started with. It is based on the workspace environment
+// so the agent registers with the server that created the workspace.
+func getAgentEnv(workspace *models.Workspace, workspaceDir string) (map[string]string, error) {
+	env := map[string]string{}
+	for key, value := range workspace.EnvVars {
+		if strings.HasPrefix(key, "DAYTONA_") {
+			env[key] = value
+		}
+	}
+
+	env["HOME"] = vmHomeDir
+	env["DAYTONA_WORKSPACE_ID"] = workspace.Id
+	env["DAYTONA_TARGET_ID"] = workspace.TargetId
+	env["DAYTONA_SERVER_API_KEY"] = workspace.ApiKey
+	env["DAYTONA_WORKSPACE_DIR"] = workspaceDir
+	env["DAYTONA_AGENT_LOG_FILE_PATH"] = vmAgentLogFile
+
+	for _, key := range []string{"DAYTONA_SERVER_URL", "DAYTONA_SERVER_API_URL"} {
+		if env[key] == "" {
+			return nil, fmt.Errorf("failed to configure Daytona agent: %s not set in the workspace environment", key)
+		}
+	}
+
+	return env, nil
+}
+
+// getAgentInstallScript returns a PowerShell script downloading the agent binary, writing the cmd script that
+// starts it with its configuration and registering the scheduled task that runs the cmd script at startup.
+func getAgentInstallScript(binaryBaseUrl, version, apiKey string, agentEnv map[string]string) (string, error) {
+	keys := make([]string, 0, len(agentEnv))
+	for key := range agentEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	agentScript := []string{windows_quote.PowerShell("@echo off")}
+	for _, key := range keys {
+		if key == "" || strings.Contains(key, "=") {
+			return "", fmt.Errorf("invalid agent environment variable name %q", key)
+		}
+		variable, err := windows_quote.Batch(fmt.Sprintf("%s=%s", key, agentEnv[key]))
+		if err != nil {
+			return "", fmt.Errorf("invalid value of agent environment variable %s: %w", key, err)
+		}
+		agentScript = append(agentScript, windows_quote.PowerShell("set "+variable))
+	}
+	agentScript = append(agentScript, windows_quote.PowerShell(fmt.Sprintf("\"%s\\daytona.exe\" agent >> \"%s\" 2>&1", vmAgentDir, vmAgentLogFile)))
+
+	return strings.Join([]string{
+		"$ErrorActionPreference = 'Stop'",
+		"$ProgressPreference = 'SilentlyContinue'",
+		fmt.Sprintf("$dir = %s", windows_quote.PowerShell(vmAgentDir)),
+		fmt.Sprintf("$version = %s", windows_quote.PowerShell(version)),
+		"New-Item -ItemType Directory -Force -Path $dir | Out-Null",
+		fmt.Sprintf("$versionFile = Join-Path $dir %s", windows_quote.PowerShell(agentVersionFile)),
+		"$binary = Join-Path $dir 'daytona.exe'",
+		fmt.Sprintf("Stop-ScheduledTask -TaskName %s -ErrorAction SilentlyContinue", windows_quote.PowerShell(agentTaskName)),
+		"Get-Process -Name daytona -ErrorAction SilentlyContinue | Stop-Process -Force",
+		"if (!(Test-Path $binary) -or !(Test-Path $versionFile) -or (Get-Content $versionFile) -ne $version) {",
+		"  $arch = if ($env:PROCESSOR_ARCHITECTURE -eq 'ARM64') { 'arm64' } else { 'amd64' }",
+		fmt.Sprintf("  $downloadUrl = %s + \"/daytona-windows-$arch.exe\"", windows_quote.PowerShell(binaryBaseUrl)),
+		"  Write-Output \"Downloading Daytona agent from $downloadUrl\"",
+		fmt.Sprintf("  Invoke-WebRequest -Uri $downloadUrl -OutFile $binary -UseBasicParsing -Headers @{ Authorization = %s }", windows_quote.PowerShell("Bearer "+apiKey)),
+		"  Set-Content -Path $versionFile -Value $version",
+		"}",
+		fmt.Sprintf("$agentScript = Join-Path $dir %s", windows_quote.PowerShell(agentScriptName)),
+		fmt.Sprintf("Set-Content -Path $agentScript -Encoding ASCII -Value @(%s)", strings.Join(agentScript, ", ")),
+		"$action = New-ScheduledTaskAction -Execute 'cmd.exe' -Argument \"/c `\"$agentScript`\"\"",
+		"$trigger = New-ScheduledTaskTrigger -AtStartup",
+		fmt.Sprintf("$principal = New-ScheduledTaskPrincipal -UserId %s -LogonType Interactive -RunLevel Limited", windows_quote.PowerShell(vmUsername)),
+		"$settings = New-ScheduledTaskSettingsSet -AllowStartIfOnBatteries -DontStopIfGoingOnBatteries -StartWhenAvailable -ExecutionTimeLimit 0",
+		fmt.Sprintf("Register-ScheduledTask -TaskName %s -Action $action -Trigger $trigger -Principal $principal -Settings $settings -Force | Out-Null", windows_quote.PowerShell(agentTaskName)),
+		fmt.Sprintf("Start-ScheduledTask -TaskName %s", windows_quote.PowerShell(agentTaskName)),
+	}, "\n"), nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultBootTimeout = 60 * time.Minute
+
+type bootPhase int
+
+const (
+	bootPhaseStarting bootPhase = iota
+	bootPhaseIsoDownload
+	bootPhaseInstall
+	bootPhaseFirstBoot
+	bootPhaseSshReachable
+	bootPhaseAgentRunning
+)
+
+func (p bootPhase) String() string {
+	switch p {
+	case bootPhaseStarting:
+		return "starting"
+	case bootPhaseIsoDownload:
+		return "ISO download"
+	case bootPhaseInstall:
+		return "install"
+	case bootPhaseFirstBoot:
+		return "first boot"
+	case bootPhaseSshReachable:
+		return "sshd reachable"
+	case bootPhaseAgentRunning:
+		return "agent running"
+	default:
+		return "unknown"
+	}
+}
+
+// nextBootPhase detects phase transitions from the container log lines of the Windows image.
+func nextBootPhase(current bootPhase, line string) bootPhase {
+	switch {
+	case strings.Contains(line, "Downloading"):
+		if current < bootPhaseIsoDownload {
+			return bootPhaseIsoDownload
+		}
+	case strings.Contains(line, "Extracting"), strings.Contains(line, "Adding drivers"), strings.Contains(line, "Building Windows"):
+		if current < bootPhaseInstall {
+			return bootPhaseInstall
+		}
+	case strings.Contains(line, "Booting Windows"):
+		// The VM boots into the installer after the ISO download and install phases, or right away into the
+		// installed Windows
+		if current < bootPhaseFirstBoot {
+			return bootPhaseFirstBoot
+		}
+	}
+
+	return current
+}
+
+type bootTracker struct {
+	mutex     sync.Mutex
+	phase     bootPhase
+	logWriter io.Writer
+}
+
+func (t *bootTracker) advance(phase bootPhase) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if phase <= t.phase {
+		return
+	}
+
+	t.phase = phase
+	if t.logWriter != nil {
+		t.logWriter.Write([]byte(fmt.Sprintf("Windows boot phase: %s\n", phase)))
+	}
+}
+
+func (t *bootTracker) current() bootPhase {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.phase
+}
+
+// WaitForWindowsBoot waits until the VM of the container accepts SSH connections and, if waitForAgent is set,
+// until the Daytona agent is running. It fails once the boot timeout of the target is reached.
+func (d *DockerClient) WaitForWindowsBoot(containerID string, hostname *string, logWriter io.Writer, waitForAgent bool) error {
+	timeout := defaultBootTimeout
+	if d.targetOptions.BootTimeout != nil && *d.targetOptions.BootTimeout > 0 {
+		timeout = time.Duration(*d.targetOptions.BootTimeout) * time.Minute
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	c, err := d.apiClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	tracker := &bootTracker{logWriter: logWriter}
+	go d.trackBootPhases(ctx, c, tracker)
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s waiting for Windows to boot, stuck in phase: %s", timeout, tracker.current())
+		case <-ticker.C:
+		}
+
+		c, err := d.apiClient.ContainerInspect(ctx, containerID)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+
+		if !c.State.Running && !c.State.Restarting {
+			return fmt.Errorf("container exited during phase %s with exit code %d: %s", tracker.current(), c.State.ExitCode, c.State.Error)
+		}
+
+		sshClient, err := d.GetSshClient(hostname, c)
+		if err != nil {
+			continue
+		}
+		tracker.advance(bootPhaseSshReachable)
+
+		if !waitForAgent {
+			sshClient.Close()
+			return nil
+		}
+
+		running := isAgentRunning(sshClient)
+		sshClient.Close()
+		if running {
+			tracker.advance(bootPhaseAgentRunning)
+			return nil
+		}
+	}
+}
+
+// trackBootPhases follows the container logs until ctx is done and advances the tracker accordingly.
+func (d *DockerClient) trackBootPhases(ctx context.Context, c types.ContainerJSON, tracker *bootTracker) {
+	logs, err := d.apiClient.ContainerLogs(ctx, c.ID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Since:      c.State.StartedAt,
+	})
+	if err != nil {
+		log.Debugf("failed to follow container logs: %v", err)
+		return
+	}
+	defer logs.Close()
+
+	reader, writer := io.Pipe()
+	go func() {
+		var err error
+		if c.Config != nil && c.Config.Tty {
+			_, err = io.Copy(writer, logs)
+		} else {
+			_, err = stdcopy.StdCopy(writer, writer, logs)
+		}
+		writer.CloseWithError(err)
+	}()
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		tracker.advance(nextBootPhase(tracker.current(), scanner.Text()))
+	}
+}
+
+func isAgentRunning(sshClient *ssh.Client) bool {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return false
+	}
+	defer session.Close()
+
+	output, err := session.Output("tasklist /FI \"IMAGENAME eq daytona.exe\" /NH")
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(output), "daytona.exe")
+}
@@ -9,7 +9,7 @@ import (
 	"io"
 	"os/exec"
 	"runtime"
-	"strings"
+	"sync"
 
 	provider_types "github.com/daytonaio/daytona-provider-windows/pkg/types"
 	"github.com/daytonaio/daytona/pkg/common"
@@ -34,6 +34,8 @@ type CreateWorkspaceOptions struct {
 type IDockerClient interface {
 	CreateWorkspace(opts *CreateWorkspaceOptions) error
 	CreateTarget(target *models.Target, targetDir string, logWriter io.Writer, sshClient *ssh.Client) error
+	StartTarget(target *models.Target, targetDir string, logWriter io.Writer, sshClient *ssh.Client) error
+	StopTarget(target *models.Target, logWriter io.Writer) error
 
 	DestroyWorkspace(workspace *models.Workspace, workspaceDir string, sshClient *ssh.Client) error
 	DestroyTarget(target *models.Target, targetDir string, sshClient *ssh.Client) error
@@ -42,29 +44,68 @@ type IDockerClient interface {
 	StopWorkspace(workspace *models.Workspace, logWriter io.Writer) error
 
 	GetWorkspaceProviderMetadata(workspace *models.Workspace) (string, error)
-	GetTargetProviderMetadata(t *models.Target) (string, error)
+	GetTargetProviderMetadata(t *models.Target, targetDir string, sshClient *ssh.Client) (string, error)
 
 	GetWorkspaceContainerName(workspace *models.Workspace) string
 	GetWorkspaceVolumeName(workspace *models.Workspace) string
 	GetContainerLogs(containerName string, logWriter io.Writer) error
 	PullImage(imageName string, cr *models.ContainerRegistry, logWriter io.Writer) error
+
+	ListGoldenImages() ([]GoldenImage, error)
+	RebuildGoldenImage(windowsVersion string, logWriter io.Writer) (*GoldenImage, error)
+	PruneGoldenImages(logWriter io.Writer) error
+
+	Close() error
 }
 
 type DockerClientConfig struct {
 	ApiClient     client.APIClient
 	TargetOptions provider_types.TargetConfigOptions
+	// CredentialsDir is a directory private to the provider where the generated VM credentials are stored
+	CredentialsDir string
+	// KnownHostsPath is the known_hosts file of the provider where VM host keys are pinned
+	KnownHostsPath string
+	// Release, if set, is called when the client is closed to release the connection to the Docker host
+	Release func()
+	// DaytonaDownloadUrl is where the Daytona server serves the install script, the agent binaries are served next to it
+	DaytonaDownloadUrl string
+	// DaytonaVersion is the version of the Daytona server, the agent installed into VMs matches it
+	DaytonaVersion string
 }
 
 func NewDockerClient(config DockerClientConfig) IDockerClient {
 	return &DockerClient{
-		apiClient:     config.ApiClient,
-		targetOptions: config.TargetOptions,
+		apiClient:          config.ApiClient,
+		targetOptions:      config.TargetOptions,
+		credentialsDir:     config.CredentialsDir,
+		knownHostsPath:     config.KnownHostsPath,
+		release:            config.Release,
+		daytonaDownloadUrl: config.DaytonaDownloadUrl,
+		daytonaVersion:     config.DaytonaVersion,
 	}
 }
 
 type DockerClient struct {
-	apiClient     client.APIClient
-	targetOptions provider_types.TargetConfigOptions
+	apiClient          client.APIClient
+	targetOptions      provider_types.TargetConfigOptions
+	credentialsDir     string
+	knownHostsPath     string
+	release            func()
+	daytonaDownloadUrl string
+	daytonaVersion     string
+	engine             *containerEngine
+	engineMutex        sync.Mutex
+	// agentForwardedConns holds the VM connections the ssh-agent is forwarded on
+	agentForwardedConns sync.Map
+}
+
+func (d *DockerClient) Close() error {
+	err := d.apiClient.Close()
+	if d.release != nil {
+		d.release()
+	}
+
+	return err
 }
 
 func (d *DockerClient) GetWorkspaceContainerName(workspace *models.Workspace) string {
@@ -83,6 +124,10 @@ func (d *DockerClient) GetWorkspaceVolumeName(workspace *models.Workspace) strin
 	return workspace.TargetId + "-" + workspace.Id
 }
 
+func (d *DockerClient) GetTargetNetworkName(targetId string) string {
+	return targetId + "-network"
+}
+
 func (d *DockerClient) OpenWebUI(hostname *string, containerData types.ContainerJSON, logWriter io.Writer) {
 	forwardedToPort := containerData.NetworkSettings.Ports["8006/tcp"][0].HostPort
 	url := fmt.Sprintf("http://localhost:%s", forwardedToPort)
@@ -112,5 +157,10 @@ func (d *DockerClient) IsLocalWindowsTarget(providerName, options, runnerId stri
 		return false
 	}
 
-	return !strings.Contains(options, "Remote Hostname") && runnerId == common.LOCAL_RUNNER_ID
+	_, isLocal, err := provider_types.ParseTargetConfigOptions(options)
+	if err != nil {
+		return false
+	}
+
+	return isLocal && runnerId == common.LOCAL_RUNNER_ID
 }
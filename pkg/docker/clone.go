@@ -0,0 +1,116 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/daytonaio/daytona-provider-windows/pkg/windows_quote"
+	"github.com/daytonaio/daytona/pkg/gitprovider"
+	"github.com/daytonaio/daytona/pkg/models"
+	"github.com/docker/docker/api/types"
+	"golang.org/x/crypto/ssh"
+)
+
+const vmGitPath = "C:\\Program Files\\Git\\bin\\git.exe"
+
+// cloneWorkspaceRepository clones the workspace repository into the workspace directory in the VM.
+// A directory already holding a clone, e.g. when the workspace is recreated on an existing disk, is left as is.
+// If agent forwarding is enabled, git runs over a connection of its own that the ssh-agent is forwarded on.
+func (d *DockerClient) cloneWorkspaceRepository(opts *CreateWorkspaceOptions, containerData types.ContainerJSON, sshClient *ssh.Client) error {
+	repo := opts.Workspace.Repository
+	if repo == nil || repo.Url == "" {
+		return nil
+	}
+
+	result, err := d.ExecInVm(context.Background(), sshClient, VmExecOptions{
+		Command: fmt.Sprintf("if (Test-Path -LiteralPath %s) { exit 0 } else { exit 1 }", windows_quote.PowerShell(opts.WorkspaceDir+"\\.git")),
+		Shell:   VmShellPowerShell,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check the workspace directory: %w", err)
+	}
+	if result.ExitCode == 0 {
+		opts.LogWriter.Write([]byte(fmt.Sprintf("Repository already cloned into %s\n", opts.WorkspaceDir)))
+		return nil
+	}
+
+	forwardAgent := d.targetOptions.AgentForwarding != nil && *d.targetOptions.AgentForwarding
+	if forwardAgent {
+		sshClient, err = d.GetSshClient(d.targetOptions.GetHostname(), containerData)
+		if err != nil {
+			return fmt.Errorf("failed to get SSH client: %w", err)
+		}
+		defer sshClient.Close()
+	}
+
+	gitOptions := func(cmd string, shell VmShell) VmExecOptions {
+		return VmExecOptions{
+			Command:      cmd,
+			Shell:        shell,
+			Stdout:       opts.LogWriter,
+			Stderr:       opts.LogWriter,
+			ForwardAgent: forwardAgent,
+		}
+	}
+
+	opts.LogWriter.Write([]byte(fmt.Sprintf("Cloning %s into %s\n", repo.Url, opts.WorkspaceDir)))
+
+	err = d.execOrFail(gitOptions(getCloneScript(repo, opts.Gpc, opts.WorkspaceDir), VmShellGitBash), sshClient)
+	if err != nil {
+		return fmt.Errorf("failed to clone repository %s into the Windows VM: %w", repo.Url, err)
+	}
+
+	if repo.Target == gitprovider.CloneTargetCommit && repo.Sha != "" {
+		cmd, err := windows_quote.CmdCommand(vmGitPath, "-C", opts.WorkspaceDir, "checkout", "--detach", repo.Sha, "--")
+		if err == nil {
+			err = d.execOrFail(gitOptions(cmd, VmShellCmd), sshClient)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check out commit %s of repository %s: %w", repo.Sha, repo.Url, err)
+		}
+	}
+
+	opts.LogWriter.Write([]byte("Repository cloned\n"))
+
+	return nil
+}
+
+// getCloneScript returns the Git Bash script cloning the repository. The script is passed on stdin and git gets
+// the git provider token from a credential helper reading it from the environment, so the token is neither on a
+// command line nor stored in the clone. Pull requests are cloned from their head branch, which the repository of
+// the workspace points to.
+func getCloneScript(repo *gitprovider.GitRepository, gpc *models.GitProviderConfig, workspaceDir string) string {
+	cloneUrl := repo.Url
+	if !strings.Contains(cloneUrl, "://") && !strings.Contains(cloneUrl, "@") {
+		cloneUrl = fmt.Sprintf("https://%s", cloneUrl)
+	}
+
+	script := []string{"set -e"}
+	args := []string{"git"}
+	if gpc != nil && gpc.Token != "" && strings.HasPrefix(cloneUrl, "http") {
+		script = append(script, fmt.Sprintf("export GIT_USERNAME=%s GIT_TOKEN=%s", shellQuote(gpc.Username), shellQuote(gpc.Token)))
+		// The empty helper disables the configured helpers, e.g. the credential manager storing the token
+		args = append(args, "-c", "credential.helper=", "-c", `credential.helper=!f() { echo "username=$GIT_USERNAME"; echo "password=$GIT_TOKEN"; }; f`)
+	}
+
+	if !strings.HasPrefix(cloneUrl, "http") {
+		// Host keys of git servers reached over SSH are accepted on first use
+		args = append(args, "-c", "core.sshCommand=ssh -o StrictHostKeyChecking=accept-new")
+	}
+
+	args = append(args, "clone", "--progress", "--single-branch")
+	if repo.Branch != "" {
+		args = append(args, "--branch", repo.Branch)
+	}
+	args = append(args, "--", cloneUrl, workspaceDir)
+
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+
+	return strings.Join(append(script, strings.Join(args, " ")), "\n")
+}
@@ -5,30 +5,254 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
+	provider_types "github.com/daytonaio/daytona-provider-windows/pkg/types"
+	"github.com/daytonaio/daytona-provider-windows/pkg/windows_quote"
 	"github.com/daytonaio/daytona/pkg/models"
 	"github.com/daytonaio/daytona/pkg/ports"
 	"github.com/daytonaio/daytona/pkg/ssh"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	log "github.com/sirupsen/logrus"
 )
 
+const workspaceImageName = "daytonaio/workspace-windows"
+
+// vmStoragePath is where the Windows VM disk is stored inside the workspace container.
+const vmStoragePath = "/storage"
+
+// workspaceStopTimeout is the number of seconds Windows is given to shut down before the container is killed.
+// It is also passed on every stop since Podman ignores the stop timeout of the container.
+const workspaceStopTimeout = 120
+
+const vmNetworkArguments = "-device e1000,netdev=net0  -netdev user,id=net0,hostfwd=tcp::22-:22,hostfwd=tcp::2222-:2222,hostfwd=tcp::2280-:2280"
+
 func (d *DockerClient) CreateTarget(target *models.Target, targetDir string, logWriter io.Writer, sshClient *ssh.Client) error {
+	ctx := context.Background()
+
+	err := d.validateHost(ctx, logWriter, sshClient)
+	if err != nil {
+		return err
+	}
+
+	err = d.createTargetResources(ctx, target, targetDir, logWriter, sshClient)
+	if err != nil {
+		return err
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Target %s created\n", target.Name)))
+
 	return nil
 }
 
+// createTargetResources creates the data directory, the shared cache directory and the network of a target.
+// It is safe to call it multiple times for the same target.
+func (d *DockerClient) createTargetResources(ctx context.Context, target *models.Target, targetDir string, logWriter io.Writer, sshClient *ssh.Client) error {
+	err := d.mkdirOnHost(targetDir, sshClient)
+	if err != nil {
+		return fmt.Errorf("failed to create target data directory %s: %w", targetDir, err)
+	}
+
+	err = d.mkdirOnHost(getTargetCacheDir(targetDir), sshClient)
+	if err != nil {
+		return fmt.Errorf("failed to create target cache directory: %w", err)
+	}
+
+	networkId, err := d.ensureTargetNetwork(ctx, target.Id)
+	if err != nil {
+		return err
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Using network %s (%s)\n", d.GetTargetNetworkName(target.Id), networkId)))
+
+	return nil
+}
+
+func (d *DockerClient) ensureTargetNetwork(ctx context.Context, targetId string) (string, error) {
+	networkName := d.GetTargetNetworkName(targetId)
+
+	networks, err := d.apiClient.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", networkName), filters.Arg("label", fmt.Sprintf("daytona.target.id=%s", targetId))),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list networks: %w", err)
+	}
+
+	for _, n := range networks {
+		if n.Name == networkName {
+			return n.ID, nil
+		}
+	}
+
+	n, err := d.apiClient.NetworkCreate(ctx, networkName, network.CreateOptions{
+		Driver: "bridge",
+		Labels: map[string]string{
+			"daytona.target.id": targetId,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create network %s: %w", networkName, err)
+	}
+
+	return n.ID, nil
+}
+
+// ensureWorkspaceVolume creates the volume holding the VM disk of a workspace if it does not exist yet.
+func (d *DockerClient) ensureWorkspaceVolume(ctx context.Context, workspace *models.Workspace, golden *GoldenImage) (*volume.Volume, error) {
+	volumeName := d.GetWorkspaceVolumeName(workspace)
+
+	v, err := d.apiClient.VolumeInspect(ctx, volumeName)
+	if err == nil {
+		return &v, nil
+	}
+	if !client.IsErrNotFound(err) {
+		return nil, fmt.Errorf("failed to inspect volume %s: %w", volumeName, err)
+	}
+
+	labels := map[string]string{
+		"daytona.target.id":    workspace.TargetId,
+		"daytona.workspace.id": workspace.Id,
+	}
+	if golden != nil {
+		labels["daytona.golden"] = golden.VolumeName
+	}
+
+	v, err = d.apiClient.VolumeCreate(ctx, volume.CreateOptions{
+		Name:   volumeName,
+		Labels: labels,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create volume %s: %w", volumeName, err)
+	}
+
+	return &v, nil
+}
+
+// getWorkspaceVmCredentials returns the stored VM credentials of a workspace or creates them.
+// VMs created from a golden image boot with the credentials of the golden image and need a new password once booted.
+func (d *DockerClient) getWorkspaceVmCredentials(workspace *models.Workspace, golden *GoldenImage) (credentials *VmCredentials, rotatePassword bool, err error) {
+	var goldenCredentials *VmCredentials
+	if golden != nil {
+		goldenCredentials, err = d.loadVmCredentials(golden.VolumeName)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load credentials of golden image %s: %w", golden.VolumeName, err)
+		}
+	}
+
+	credentials, err = d.loadVmCredentials(workspace.Id)
+	if err == nil {
+		return credentials, goldenCredentials != nil && credentials.Password == goldenCredentials.Password, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+
+	if goldenCredentials != nil {
+		credentials = goldenCredentials
+		rotatePassword = true
+	} else {
+		credentials, err = generateVmCredentials()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	err = d.saveVmCredentials(workspace.Id, credentials)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to save VM credentials: %w", err)
+	}
+
+	return credentials, rotatePassword, nil
+}
+
+func getTargetCacheDir(targetDir string) string {
+	return path.Join(targetDir, "cache")
+}
+
 func (d *DockerClient) CreateWorkspace(opts *CreateWorkspaceOptions) error {
 	ctx := context.TODO()
-	mounts := []mount.Mount{}
 
-	cr := opts.ContainerRegistries.FindContainerRegistryByImageName("daytonaio/workspace-windows")
-	err := d.PullImage("daytonaio/workspace-windows", cr, opts.LogWriter)
+	cr := opts.ContainerRegistries.FindContainerRegistryByImageName(workspaceImageName)
+	err := d.PullImage(workspaceImageName, cr, opts.LogWriter)
+	if err != nil {
+		return err
+	}
+
+	var golden *GoldenImage
+	if d.isGoldenImageCacheEnabled() {
+		vmSettings := getVmSettings(opts.Workspace.EnvVars, d.targetOptions)
+		if opts.Workspace.EnvVars[rebuildGoldenImageEnvVar] == "true" {
+			golden, err = d.RebuildGoldenImage(getWindowsVersion(vmSettings), opts.LogWriter)
+		} else {
+			golden, err = d.EnsureGoldenImage(vmSettings, opts.LogWriter)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to prepare golden image: %w", err)
+		}
+	}
+
+	workspaceVolume, err := d.ensureWorkspaceVolume(ctx, opts.Workspace, golden)
+	if err != nil {
+		return err
+	}
+	volumeName := workspaceVolume.Name
+
+	// The VM disk of an existing volume stays on the golden image it was created from
+	golden, err = d.getGoldenImage(ctx, workspaceVolume.Labels["daytona.golden"])
+	if err != nil {
+		return err
+	}
+
+	mounts := []mount.Mount{
+		{
+			Type:   mount.TypeVolume,
+			Source: volumeName,
+			Target: vmStoragePath,
+		},
+	}
+
+	if golden != nil {
+		err = d.initVolumeFromGoldenImage(ctx, volumeName, golden)
+		if err != nil {
+			return err
+		}
+
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   golden.VolumeName,
+			Target:   goldenImagePath,
+			ReadOnly: true,
+		})
+	}
+
+	credentials, rotatePassword, err := d.getWorkspaceVmCredentials(opts.Workspace, golden)
+	if err != nil {
+		return err
+	}
+
+	// A container left over from a previous attempt is replaced, the installed disk is kept in the volume
+	err = d.apiClient.ContainerRemove(ctx, d.GetWorkspaceContainerName(opts.Workspace), container.RemoveOptions{
+		Force: true,
+	})
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove existing container: %w", err)
+	}
+
+	networkId, err := d.ensureTargetNetwork(ctx, opts.Workspace.TargetId)
 	if err != nil {
 		return err
 	}
@@ -76,30 +300,26 @@ func (d *DockerClient) CreateWorkspace(opts *CreateWorkspaceOptions) error {
 		}
 	}
 
-	c, err := d.apiClient.ContainerCreate(ctx, GetContainerCreateConfig(opts.Workspace, availablePort), &container.HostConfig{
-		Privileged: true,
-		Mounts:     mounts,
-		ExtraHosts: []string{
-			"host.docker.internal:host-gateway",
-		},
-		PortBindings: portBindings,
-		Resources: container.Resources{
-			Devices: []container.DeviceMapping{
-				{
-					PathOnHost:      "/dev/kvm",
-					PathInContainer: "/dev/kvm",
-				},
-				{
-					PathOnHost:      "/dev/net/tun",
-					PathInContainer: "/dev/net/tun",
-				},
+	containerConfig := GetContainerCreateConfig(opts.Workspace, d.targetOptions, availablePort)
+	containerConfig.Env = append(containerConfig.Env, fmt.Sprintf("USERNAME=%s", credentials.Username), fmt.Sprintf("PASSWORD=%s", credentials.Password))
+	if golden != nil {
+		containerConfig.Env = append(containerConfig.Env, "DISK_FMT=qcow2")
+		containerConfig.Labels["daytona.golden"] = golden.VolumeName
+	}
+
+	hostConfig, err := d.getWorkspaceHostConfig(ctx, mounts, portBindings)
+	if err != nil {
+		return err
+	}
+
+	c, err := d.apiClient.ContainerCreate(ctx, containerConfig, hostConfig, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			d.GetTargetNetworkName(opts.Workspace.TargetId): {
+				NetworkID: networkId,
+				Aliases:   []string{opts.Workspace.Name},
 			},
 		},
-		CapAdd: []string{
-			"NET_ADMIN",
-			"SYS_ADMIN",
-		},
-	}, nil, nil, d.GetWorkspaceContainerName(opts.Workspace))
+	}, nil, d.GetWorkspaceContainerName(opts.Workspace))
 	if err != nil {
 		return fmt.Errorf("failed to create container: %w", err)
 	}
@@ -124,27 +344,40 @@ func (d *DockerClient) CreateWorkspace(opts *CreateWorkspaceOptions) error {
 
 	opts.LogWriter.Write([]byte("Installing Windows.....\n"))
 
-	d.OpenWebUI(d.targetOptions.RemoteHostname, containerData, opts.LogWriter)
+	d.OpenWebUI(d.targetOptions.GetHostname(), containerData, opts.LogWriter)
 
-	err = d.WaitForWindowsBoot(c.ID, d.targetOptions.RemoteHostname)
+	err = d.WaitForWindowsBoot(c.ID, d.targetOptions.GetHostname(), opts.LogWriter, false)
 	if err != nil {
 		return fmt.Errorf("failed to wait for Windows to boot: %w", err)
 	}
 
-	sshClient, err := d.GetSshClient(d.targetOptions.RemoteHostname, containerData)
+	sshClient, err := d.GetSshClient(d.targetOptions.GetHostname(), containerData)
 	if err != nil {
 		return fmt.Errorf("failed to get SSH client: %w", err)
 	}
+	defer sshClient.Close()
 
-	for key, env := range opts.Workspace.EnvVars {
-		err = d.ExecuteCommand(fmt.Sprintf("setx %s \"%s\"", key, env), nil, sshClient)
+	if rotatePassword {
+		err = d.rotateVmPassword(opts.Workspace.Id, sshClient)
 		if err != nil {
-			opts.LogWriter.Write([]byte(fmt.Sprintf("failed to set env variable %s to %s: %s\n", key, env, err.Error())))
+			return err
+		}
+	}
+
+	script, err := getUserEnvScript(opts.Workspace.EnvVars)
+	if err != nil {
+		opts.LogWriter.Write([]byte(fmt.Sprintf("failed to set env variables: %s\n", err.Error())))
+	}
+	if script != "" {
+		err = d.executePowerShell(script, opts.LogWriter, sshClient)
+		if err != nil {
+			opts.LogWriter.Write([]byte(fmt.Sprintf("failed to set env variables: %s\n", err.Error())))
 		}
 	}
 
 	extraEnv := []string{
-		fmt.Sprintf("setx HOME \"%s\"", "C:\\Users\\daytona"),
+		fmt.Sprintf("setx HOME %s", vmHomeDir),
+		// %PATH% is expanded by cmd.exe on purpose
 		"setx /M PATH \"%PATH%;C:\\Program Files\\Git\\bin\"",
 	}
 	for _, cmd := range extraEnv {
@@ -154,14 +387,39 @@ func (d *DockerClient) CreateWorkspace(opts *CreateWorkspaceOptions) error {
 		}
 	}
 
+	err = d.cloneWorkspaceRepository(opts, containerData, sshClient)
+	if err != nil {
+		return err
+	}
+
+	err = d.installDaytonaAgent(opts.Workspace, opts.WorkspaceDir, d.daytonaDownloadUrl, opts.LogWriter, sshClient)
+	if err != nil {
+		return err
+	}
+
+	err = d.WaitForWindowsBoot(c.ID, d.targetOptions.GetHostname(), opts.LogWriter, true)
+	if err != nil {
+		return fmt.Errorf("failed to wait for the Daytona agent to start: %w", err)
+	}
+
 	return nil
 }
 
-func GetContainerCreateConfig(workspace *models.Workspace, toolboxApiHostPort *uint16) *container.Config {
+func GetContainerCreateConfig(workspace *models.Workspace, targetOptions provider_types.TargetConfigOptions, toolboxApiHostPort *uint16) *container.Config {
 	envVars := []string{
-		fmt.Sprintf("ARGUMENTS=%s", "-device e1000,netdev=net0  -netdev user,id=net0,hostfwd=tcp::22-:22,hostfwd=tcp::2222-:2222,hostfwd=tcp::2280-:2280"),
+		fmt.Sprintf("ARGUMENTS=%s", vmNetworkArguments),
 	}
+
+	vmSettings := getVmSettings(workspace.EnvVars, targetOptions)
+
 	for key, value := range workspace.EnvVars {
+		if _, ok := vmSettings[key]; ok {
+			continue
+		}
+		envVars = append(envVars, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	for key, value := range vmSettings {
 		envVars = append(envVars, fmt.Sprintf("%s=%s", key, value))
 	}
 
@@ -171,6 +429,10 @@ func GetContainerCreateConfig(workspace *models.Workspace, toolboxApiHostPort *u
 		"daytona.workspace.repository.url": workspace.Repository.Url,
 	}
 
+	if version, ok := vmSettings["VERSION"]; ok {
+		labels["daytona.windows.version"] = version
+	}
+
 	if toolboxApiHostPort != nil {
 		labels["daytona.toolbox.api.hostPort"] = fmt.Sprintf("%d", *toolboxApiHostPort)
 	}
@@ -185,7 +447,7 @@ func GetContainerCreateConfig(workspace *models.Workspace, toolboxApiHostPort *u
 
 	return &container.Config{
 		Hostname: workspace.Id,
-		Image:    "daytonaio/workspace-windows:latest",
+		Image:    workspaceImageName + ":latest",
 		Labels:   labels,
 		User:     "root",
 		Entrypoint: []string{
@@ -197,6 +459,110 @@ func GetContainerCreateConfig(workspace *models.Workspace, toolboxApiHostPort *u
 		AttachStdout: true,
 		AttachStderr: true,
 		ExposedPorts: exposedPorts,
-		StopTimeout:  &[]int{120}[0],
+		StopTimeout:  &[]int{workspaceStopTimeout}[0],
 	}
 }
+
+// getUserEnvScript returns the PowerShell script storing envVars for the VM user. Variables Windows can't store are
+// left out of the script and returned as an error. Unlike setx, values are neither taken for switches nor truncated.
+func getUserEnvScript(envVars map[string]string) (string, error) {
+	keys := make([]string, 0, len(envVars))
+	for key := range envVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var script []string
+	var errs []error
+	for _, key := range keys {
+		value := envVars[key]
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			errs = append(errs, fmt.Errorf("invalid env variable name %q", key))
+			continue
+		}
+		if strings.Contains(value, "\x00") {
+			errs = append(errs, fmt.Errorf("invalid value of env variable %s", key))
+			continue
+		}
+
+		script = append(script, fmt.Sprintf("[Environment]::SetEnvironmentVariable(%s, %s, 'User')", windows_quote.PowerShell(key), windows_quote.PowerShell(value)))
+	}
+
+	return strings.Join(script, "\n"), errors.Join(errs...)
+}
+
+// getVmSettings returns the VM settings passed to the Windows image as env vars.
+// Values from the target options can be overridden by workspace env vars.
+func getVmSettings(envVars map[string]string, targetOptions provider_types.TargetConfigOptions) map[string]string {
+	vmSettings := map[string]string{}
+	if targetOptions.CpuCores != nil && *targetOptions.CpuCores > 0 {
+		vmSettings["CPU_CORES"] = fmt.Sprintf("%d", *targetOptions.CpuCores)
+	}
+	if targetOptions.RamSize != nil && *targetOptions.RamSize != "" {
+		vmSettings["RAM_SIZE"] = *targetOptions.RamSize
+	}
+	if targetOptions.DiskSize != nil && *targetOptions.DiskSize != "" {
+		vmSettings["DISK_SIZE"] = *targetOptions.DiskSize
+	}
+	if targetOptions.WindowsVersion != nil && *targetOptions.WindowsVersion != "" {
+		vmSettings["VERSION"] = *targetOptions.WindowsVersion
+	}
+
+	for _, key := range []string{"CPU_CORES", "RAM_SIZE", "DISK_SIZE", "VERSION"} {
+		if value, ok := envVars[key]; ok {
+			vmSettings[key] = value
+		}
+	}
+
+	return vmSettings
+}
+
+// getWorkspaceHostConfig returns the host config of a container running a Windows VM, adjusted to the container engine.
+func (d *DockerClient) getWorkspaceHostConfig(ctx context.Context, mounts []mount.Mount, portBindings nat.PortMap) (*container.HostConfig, error) {
+	engine, err := d.getContainerEngine(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hostConfig := &container.HostConfig{
+		Privileged: true,
+		Mounts:     mounts,
+		ExtraHosts: []string{
+			"host.docker.internal:host-gateway",
+		},
+		PortBindings: portBindings,
+		Resources: container.Resources{
+			Devices: []container.DeviceMapping{
+				{
+					PathOnHost:        "/dev/kvm",
+					PathInContainer:   "/dev/kvm",
+					CgroupPermissions: "rwm",
+				},
+				{
+					PathOnHost:        "/dev/net/tun",
+					PathInContainer:   "/dev/net/tun",
+					CgroupPermissions: "rwm",
+				},
+			},
+		},
+		CapAdd: []string{
+			"NET_ADMIN",
+			"SYS_ADMIN",
+		},
+	}
+
+	if engine.Podman {
+		// Podman adds host.docker.internal and host.containers.internal itself and older versions
+		// don't resolve host-gateway
+		hostConfig.ExtraHosts = nil
+	}
+
+	if engine.Rootless {
+		// A rootless container can't be privileged beyond the user. The VM only needs the devices, which the
+		// user reaches through supplementary groups like kvm that are dropped unless kept explicitly.
+		hostConfig.Privileged = false
+		hostConfig.GroupAdd = []string{"keep-groups"}
+	}
+
+	return hostConfig, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetUserEnvScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		envVars map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"none", nil, "", false},
+		{"plain", map[string]string{"DAYTONA_WS_ID": "abc"}, "[Environment]::SetEnvironmentVariable('DAYTONA_WS_ID', 'abc', 'User')", false},
+		{"sorted", map[string]string{"B": "2", "A": "1"}, "[Environment]::SetEnvironmentVariable('A', '1', 'User')\n[Environment]::SetEnvironmentVariable('B', '2', 'User')", false},
+		{"value starting with a dash", map[string]string{"JAVA_OPTS": "-Xmx2g"}, "[Environment]::SetEnvironmentVariable('JAVA_OPTS', '-Xmx2g', 'User')", false},
+		{"value like a switch", map[string]string{"K": "/M"}, "[Environment]::SetEnvironmentVariable('K', '/M', 'User')", false},
+		{"path", map[string]string{"K": "/opt/tool"}, "[Environment]::SetEnvironmentVariable('K', '/opt/tool', 'User')", false},
+		{"quotes", map[string]string{"K": `it's "x"`}, `[Environment]::SetEnvironmentVariable('K', 'it''s "x"', 'User')`, false},
+		{"typographic quotes", map[string]string{"K": "‘a’"}, "[Environment]::SetEnvironmentVariable('K', '‘‘a’’', 'User')", false},
+		{"variables", map[string]string{"K": "$env:PATH %PATH% !X!"}, "[Environment]::SetEnvironmentVariable('K', '$env:PATH %PATH% !X!', 'User')", false},
+		{"newline", map[string]string{"K": "a\nb"}, "[Environment]::SetEnvironmentVariable('K', 'a\nb', 'User')", false},
+		{"long", map[string]string{"K": strings.Repeat("a", 2048)}, "[Environment]::SetEnvironmentVariable('K', '" + strings.Repeat("a", 2048) + "', 'User')", false},
+		{"NUL", map[string]string{"K": "a\x00b", "L": "1"}, "[Environment]::SetEnvironmentVariable('L', '1', 'User')", true},
+		{"empty name", map[string]string{"": "v", "L": "1"}, "[Environment]::SetEnvironmentVariable('L', '1', 'User')", true},
+		{"name with equals sign", map[string]string{"A=B": "v"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getUserEnvScript(tt.envVars)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getUserEnvScript(%q) error = %v, want error %t", tt.envVars, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getUserEnvScript(%q) = %q, want %q", tt.envVars, got, tt.want)
+			}
+		})
+	}
+}
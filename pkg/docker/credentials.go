@@ -0,0 +1,155 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const vmUsername = "daytona"
+
+// legacyVmPassword is the password of VMs created before credentials were generated per workspace.
+const legacyVmPassword = "daytona"
+
+const vmPasswordCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// VmCredentials are the credentials of the Windows user of a VM.
+type VmCredentials struct {
+	Username string
+	Password string
+	// PendingPassword is set while the password of the VM user is changed to it
+	PendingPassword string `json:",omitempty"`
+}
+
+func generateVmCredentials() (*VmCredentials, error) {
+	password := make([]byte, 24)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(vmPasswordCharset))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate VM password: %w", err)
+		}
+		password[i] = vmPasswordCharset[n.Int64()]
+	}
+
+	return &VmCredentials{
+		Username: vmUsername,
+		Password: string(password),
+	}, nil
+}
+
+// getCredentialsId returns the id the VM credentials of a container are stored under.
+func getCredentialsId(containerData types.ContainerJSON) string {
+	if containerData.Config == nil {
+		return ""
+	}
+
+	if workspaceId, ok := containerData.Config.Labels["daytona.workspace.id"]; ok {
+		return workspaceId
+	}
+
+	return containerData.Config.Labels["daytona.golden"]
+}
+
+func (d *DockerClient) getVmCredentialsPath(id string) (string, error) {
+	if d.credentialsDir == "" {
+		return "", errors.New("credentials directory not set")
+	}
+
+	if id == "" || filepath.Base(id) != id {
+		return "", fmt.Errorf("invalid credentials id %q", id)
+	}
+
+	return filepath.Join(d.credentialsDir, id+".json"), nil
+}
+
+// loadVmCredentials returns an error wrapping os.ErrNotExist if no credentials are stored for the id.
+func (d *DockerClient) loadVmCredentials(id string) (*VmCredentials, error) {
+	credentialsPath, err := d.getVmCredentialsPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials VmCredentials
+	err = json.Unmarshal(content, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse VM credentials %s: %w", credentialsPath, err)
+	}
+
+	return &credentials, nil
+}
+
+// getVmCredentials falls back to the legacy credentials for VMs without stored credentials.
+func (d *DockerClient) getVmCredentials(containerData types.ContainerJSON) (*VmCredentials, error) {
+	credentials, err := d.loadVmCredentials(getCredentialsId(containerData))
+	if err == nil {
+		return credentials, nil
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return &VmCredentials{
+			Username: vmUsername,
+			Password: legacyVmPassword,
+		}, nil
+	}
+
+	return nil, err
+}
+
+func (d *DockerClient) saveVmCredentials(id string, credentials *VmCredentials) error {
+	credentialsPath, err := d.getVmCredentialsPath(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(credentialsPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(credentialsPath, content, 0600)
+}
+
+// resolvePendingVmPassword stores password, which the VM accepted, as the password of an interrupted password change.
+func (d *DockerClient) resolvePendingVmPassword(id string, credentials *VmCredentials, password string) {
+	err := d.saveVmCredentials(id, &VmCredentials{
+		Username: credentials.Username,
+		Password: password,
+	})
+	if err != nil {
+		log.Warnf("failed to save VM credentials: %v", err)
+	}
+}
+
+func (d *DockerClient) removeVmCredentials(id string) error {
+	credentialsPath, err := d.getVmCredentialsPath(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(credentialsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
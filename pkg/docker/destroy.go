@@ -5,15 +5,75 @@ package docker
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/daytonaio/daytona/pkg/models"
 	"github.com/daytonaio/daytona/pkg/ssh"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 )
 
 func (d *DockerClient) DestroyTarget(target *models.Target, targetDir string, sshClient *ssh.Client) error {
-	return nil
+	ctx := context.Background()
+	targetFilter := filters.NewArgs(filters.Arg("label", fmt.Sprintf("daytona.target.id=%s", target.Id)))
+
+	containers, err := d.apiClient.ContainerList(ctx, container.ListOptions{
+		Filters: targetFilter,
+		All:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list target containers: %w", err)
+	}
+
+	for _, c := range containers {
+		err = d.apiClient.ContainerRemove(ctx, c.ID, container.RemoveOptions{
+			Force:         true,
+			RemoveVolumes: true,
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove container %s: %w", c.ID, err)
+		}
+
+		if workspaceId, ok := c.Labels["daytona.workspace.id"]; ok {
+			err = d.forgetVm(workspaceId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	volumes, err := d.apiClient.VolumeList(ctx, volume.ListOptions{
+		Filters: targetFilter,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list target volumes: %w", err)
+	}
+
+	for _, v := range volumes.Volumes {
+		err = d.apiClient.VolumeRemove(ctx, v.Name, true)
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove volume %s: %w", v.Name, err)
+		}
+	}
+
+	networks, err := d.apiClient.NetworkList(ctx, network.ListOptions{
+		Filters: targetFilter,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list target networks: %w", err)
+	}
+
+	for _, n := range networks {
+		err = d.apiClient.NetworkRemove(ctx, n.ID)
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove network %s: %w", n.Name, err)
+		}
+	}
+
+	return d.removeFromHost(targetDir, sshClient)
 }
 
 func (d *DockerClient) DestroyWorkspace(workspace *models.Workspace, workspaceDir string, sshClient *ssh.Client) error {
@@ -29,10 +89,15 @@ func (d *DockerClient) DestroyWorkspace(workspace *models.Workspace, workspaceDi
 		return err
 	}
 
-	err = d.apiClient.VolumeRemove(ctx, containerName, true)
+	err = d.apiClient.VolumeRemove(ctx, d.GetWorkspaceVolumeName(workspace), true)
 	if err != nil && !client.IsErrNotFound(err) {
 		return err
 	}
 
+	err = d.forgetVm(workspace.Id)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,67 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// containerEngine describes the engine serving the Docker API of the target.
+type containerEngine struct {
+	// Podman is set for Podman engines exposing the Docker compatible API
+	Podman bool
+	// Rootless is set for rootless Podman engines, which can't grant more privileges than the user has
+	Rootless bool
+}
+
+// getContainerEngine detects the container engine of the target. The result is cached for the lifetime of the client.
+func (d *DockerClient) getContainerEngine(ctx context.Context) (*containerEngine, error) {
+	d.engineMutex.Lock()
+	defer d.engineMutex.Unlock()
+
+	if d.engine != nil {
+		return d.engine, nil
+	}
+
+	version, err := d.apiClient.ServerVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container engine version: %w", err)
+	}
+
+	engine := &containerEngine{}
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), "podman") {
+			engine.Podman = true
+		}
+	}
+
+	if engine.Podman {
+		info, err := d.apiClient.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get container engine info: %w", err)
+		}
+
+		for _, securityOption := range info.SecurityOptions {
+			if strings.Contains(securityOption, "rootless") {
+				engine.Rootless = true
+			}
+		}
+	}
+
+	d.engine = engine
+
+	return engine, nil
+}
+
+func (e *containerEngine) String() string {
+	if !e.Podman {
+		return "Docker"
+	}
+	if e.Rootless {
+		return "Podman (rootless)"
+	}
+	return "Podman"
+}
@@ -0,0 +1,535 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/daytonaio/daytona/pkg/ports"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// goldenImagePath is where the golden image volume is mounted read-only in workspace containers.
+const goldenImagePath = "/golden"
+
+// goldenImageReadyMarker is created in the golden image volume once Windows is installed and shut down.
+const goldenImageReadyMarker = "daytona.golden.ready"
+
+const defaultWindowsVersion = "11"
+
+// rebuildGoldenImageEnvVar is the workspace env var that makes CreateWorkspace replace the golden image of the
+// workspace's Windows version with a fresh install instead of reusing it.
+const rebuildGoldenImageEnvVar = "REBUILD_GOLDEN_IMAGE"
+
+// goldenImageMutex prevents concurrent workspace creations from building the same golden image twice.
+var goldenImageMutex sync.Mutex
+
+// GoldenImage is a fully installed Windows disk shared by the workspaces of a Docker host.
+// Workspace disks are copy-on-write overlays on top of it.
+type GoldenImage struct {
+	VolumeName      string
+	WindowsVersion  string
+	SetupScriptHash string
+	CreatedAt       string
+	Workspaces      int
+}
+
+func (d *DockerClient) isGoldenImageCacheEnabled() bool {
+	return d.targetOptions.GoldenImageCache == nil || *d.targetOptions.GoldenImageCache
+}
+
+func getWindowsVersion(vmSettings map[string]string) string {
+	if version, ok := vmSettings["VERSION"]; ok {
+		return version
+	}
+
+	return defaultWindowsVersion
+}
+
+func getGoldenImageName(windowsVersion, setupScriptHash string) string {
+	return fmt.Sprintf("daytona-windows-golden-%s-%s", windowsVersion, setupScriptHash[:12])
+}
+
+// ListGoldenImages returns the golden images present on the Docker host.
+func (d *DockerClient) ListGoldenImages() ([]GoldenImage, error) {
+	ctx := context.Background()
+
+	goldenVolumes, err := d.apiClient.VolumeList(ctx, volume.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", "daytona.golden.version")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list golden images: %w", err)
+	}
+
+	workspaceVolumes, err := d.apiClient.VolumeList(ctx, volume.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", "daytona.golden")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace volumes: %w", err)
+	}
+
+	usage := map[string]int{}
+	for _, v := range workspaceVolumes.Volumes {
+		usage[v.Labels["daytona.golden"]]++
+	}
+
+	goldenImages := []GoldenImage{}
+	for _, v := range goldenVolumes.Volumes {
+		goldenImages = append(goldenImages, GoldenImage{
+			VolumeName:      v.Name,
+			WindowsVersion:  v.Labels["daytona.golden.version"],
+			SetupScriptHash: v.Labels["daytona.golden.setup.hash"],
+			CreatedAt:       v.CreatedAt,
+			Workspaces:      usage[v.Name],
+		})
+	}
+
+	sort.Slice(goldenImages, func(i, j int) bool {
+		return goldenImages[i].VolumeName < goldenImages[j].VolumeName
+	})
+
+	return goldenImages, nil
+}
+
+// EnsureGoldenImage returns the golden image matching the Windows version and the setup scripts of the
+// workspace image, building it first if it does not exist on the Docker host yet.
+func (d *DockerClient) EnsureGoldenImage(vmSettings map[string]string, logWriter io.Writer) (*GoldenImage, error) {
+	ctx := context.Background()
+
+	goldenImageMutex.Lock()
+	defer goldenImageMutex.Unlock()
+
+	setupScriptHash, err := d.getSetupScriptHash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	windowsVersion := getWindowsVersion(vmSettings)
+	name := getGoldenImageName(windowsVersion, setupScriptHash)
+
+	golden, err := d.getGoldenImage(ctx, name)
+	if err != nil && !client.IsErrNotFound(err) {
+		return nil, err
+	}
+
+	if golden != nil {
+		ready, err := d.isGoldenImageReady(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if ready {
+			logWriter.Write([]byte(fmt.Sprintf("Using golden image %s\n", name)))
+			return golden, nil
+		}
+
+		logWriter.Write([]byte(fmt.Sprintf("Golden image %s is incomplete, rebuilding it\n", name)))
+		err = d.removeGoldenImage(ctx, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove incomplete golden image %s: %w", name, err)
+		}
+	}
+
+	return d.buildGoldenImage(ctx, name, windowsVersion, setupScriptHash, vmSettings, logWriter)
+}
+
+// RebuildGoldenImage replaces the golden image of a Windows version with a fresh install.
+// Golden images used by workspaces can not be rebuilt.
+func (d *DockerClient) RebuildGoldenImage(windowsVersion string, logWriter io.Writer) (*GoldenImage, error) {
+	ctx := context.Background()
+
+	goldenImageMutex.Lock()
+	defer goldenImageMutex.Unlock()
+
+	setupScriptHash, err := d.getSetupScriptHash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := getGoldenImageName(windowsVersion, setupScriptHash)
+
+	goldenImages, err := d.ListGoldenImages()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range goldenImages {
+		if g.VolumeName == name && g.Workspaces > 0 {
+			return nil, fmt.Errorf("golden image %s is used by %d workspaces", name, g.Workspaces)
+		}
+	}
+
+	err = d.removeGoldenImage(ctx, name, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove golden image %s: %w", name, err)
+	}
+
+	vmSettings := getVmSettings(nil, d.targetOptions)
+	vmSettings["VERSION"] = windowsVersion
+
+	return d.buildGoldenImage(ctx, name, windowsVersion, setupScriptHash, vmSettings, logWriter)
+}
+
+// PruneGoldenImages removes the golden images that were built from outdated setup scripts
+// and are not used by any workspace.
+func (d *DockerClient) PruneGoldenImages(logWriter io.Writer) error {
+	ctx := context.Background()
+
+	goldenImageMutex.Lock()
+	defer goldenImageMutex.Unlock()
+
+	setupScriptHash, err := d.getSetupScriptHash(ctx)
+	if err != nil {
+		return err
+	}
+
+	goldenImages, err := d.ListGoldenImages()
+	if err != nil {
+		return err
+	}
+
+	for _, g := range goldenImages {
+		if g.SetupScriptHash == setupScriptHash || g.Workspaces > 0 {
+			continue
+		}
+
+		err = d.removeGoldenImage(ctx, g.VolumeName, false)
+		if err != nil {
+			return fmt.Errorf("failed to remove golden image %s: %w", g.VolumeName, err)
+		}
+
+		if logWriter != nil {
+			logWriter.Write([]byte(fmt.Sprintf("Removed outdated golden image %s\n", g.VolumeName)))
+		}
+	}
+
+	return nil
+}
+
+func (d *DockerClient) removeGoldenImage(ctx context.Context, name string, force bool) error {
+	err := d.apiClient.VolumeRemove(ctx, name, force)
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+
+	return d.forgetVm(name)
+}
+
+// getGoldenImage returns nil if name is empty.
+func (d *DockerClient) getGoldenImage(ctx context.Context, name string) (*GoldenImage, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	v, err := d.apiClient.VolumeInspect(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect golden image %s: %w", name, err)
+	}
+
+	return &GoldenImage{
+		VolumeName:      v.Name,
+		WindowsVersion:  v.Labels["daytona.golden.version"],
+		SetupScriptHash: v.Labels["daytona.golden.setup.hash"],
+		CreatedAt:       v.CreatedAt,
+	}, nil
+}
+
+func (d *DockerClient) isGoldenImageReady(ctx context.Context, name string) (bool, error) {
+	exitCode, err := d.runHelperContainer(ctx, []mount.Mount{
+		{
+			Type:     mount.TypeVolume,
+			Source:   name,
+			Target:   goldenImagePath,
+			ReadOnly: true,
+		},
+	}, fmt.Sprintf("test -f %s/%s", goldenImagePath, goldenImageReadyMarker), nil)
+	if err != nil {
+		return false, err
+	}
+
+	return exitCode == 0, nil
+}
+
+func (d *DockerClient) buildGoldenImage(ctx context.Context, name, windowsVersion, setupScriptHash string, vmSettings map[string]string, logWriter io.Writer) (golden *GoldenImage, err error) {
+	logWriter.Write([]byte(fmt.Sprintf("Building golden image %s. Windows is installed once per host, this can take a while...\n", name)))
+
+	_, err = d.apiClient.VolumeCreate(ctx, volume.CreateOptions{
+		Name: name,
+		Labels: map[string]string{
+			"daytona.golden.version":    windowsVersion,
+			"daytona.golden.setup.hash": setupScriptHash,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create golden image volume: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			d.apiClient.VolumeRemove(context.Background(), name, true)
+		}
+	}()
+
+	credentials, err := generateVmCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.saveVmCredentials(name, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save golden image credentials: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			d.forgetVm(name)
+		}
+	}()
+
+	sshPort, err := ports.GetAvailableEphemeralPort()
+	if err != nil {
+		return nil, err
+	}
+
+	envVars := []string{
+		fmt.Sprintf("ARGUMENTS=%s", vmNetworkArguments),
+		"DISK_FMT=qcow2",
+		fmt.Sprintf("USERNAME=%s", credentials.Username),
+		fmt.Sprintf("PASSWORD=%s", credentials.Password),
+	}
+	for key, value := range vmSettings {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	builderName := name + "-builder"
+	err = d.apiClient.ContainerRemove(ctx, builderName, container.RemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		return nil, err
+	}
+
+	hostConfig, err := d.getWorkspaceHostConfig(ctx, []mount.Mount{
+		{
+			Type:   mount.TypeVolume,
+			Source: name,
+			Target: vmStoragePath,
+		},
+	}, nat.PortMap{
+		"22/tcp": []nat.PortBinding{
+			{
+				HostIP:   "0.0.0.0",
+				HostPort: fmt.Sprintf("%d", sshPort),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := d.apiClient.ContainerCreate(ctx, &container.Config{
+		Image: workspaceImageName + ":latest",
+		Labels: map[string]string{
+			"daytona.golden": name,
+		},
+		User: "root",
+		Entrypoint: []string{
+			"/usr/bin/tini",
+			"-s",
+			"/run/entry.sh",
+		},
+		Env: envVars,
+		ExposedPorts: nat.PortSet{
+			"22/tcp": struct{}{},
+		},
+	}, hostConfig, nil, nil, builderName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create golden image builder: %w", err)
+	}
+	defer d.apiClient.ContainerRemove(context.Background(), c.ID, container.RemoveOptions{Force: true})
+
+	err = d.apiClient.ContainerStart(ctx, c.ID, container.StartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start golden image builder: %w", err)
+	}
+
+	err = d.WaitForWindowsBoot(c.ID, d.targetOptions.GetHostname(), logWriter, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for golden image install: %w", err)
+	}
+
+	logWriter.Write([]byte("Windows installed, shutting down golden image builder\n"))
+
+	// The image entrypoint shuts Windows down gracefully on SIGTERM
+	err = d.apiClient.ContainerStop(ctx, c.ID, container.StopOptions{
+		Timeout: &[]int{int((5 * time.Minute).Seconds())}[0],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stop golden image builder: %w", err)
+	}
+
+	exitCode, err := d.runHelperContainer(ctx, []mount.Mount{
+		{
+			Type:   mount.TypeVolume,
+			Source: name,
+			Target: goldenImagePath,
+		},
+	}, fmt.Sprintf("touch %s/%s", goldenImagePath, goldenImageReadyMarker), nil)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("failed to mark golden image %s as ready: exit code %d", name, exitCode)
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Golden image %s built\n", name)))
+
+	return d.getGoldenImage(ctx, name)
+}
+
+// initVolumeFromGoldenImage creates the VM disk of a workspace as an overlay of the golden image disk.
+// Volumes that already hold a disk are left untouched.
+func (d *DockerClient) initVolumeFromGoldenImage(ctx context.Context, volumeName string, golden *GoldenImage) error {
+	cmd := fmt.Sprintf(`set -e
+if ls %[1]s/data.* >/dev/null 2>&1; then exit 0; fi
+for f in %[2]s/*; do
+	case "$(basename "$f")" in
+		data.qcow2|%[3]s) ;;
+		*) cp -a "$f" %[1]s/ ;;
+	esac
+done
+qemu-img create -f qcow2 -b %[2]s/data.qcow2 -F qcow2 %[1]s/data.qcow2`, vmStoragePath, goldenImagePath, goldenImageReadyMarker)
+
+	exitCode, err := d.runHelperContainer(ctx, []mount.Mount{
+		{
+			Type:   mount.TypeVolume,
+			Source: volumeName,
+			Target: vmStoragePath,
+		},
+		{
+			Type:     mount.TypeVolume,
+			Source:   golden.VolumeName,
+			Target:   goldenImagePath,
+			ReadOnly: true,
+		},
+	}, cmd, nil)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("failed to create workspace disk from golden image %s: exit code %d", golden.VolumeName, exitCode)
+	}
+
+	return nil
+}
+
+// getSetupScriptHash returns the hash of the setup scripts baked into the workspace image.
+func (d *DockerClient) getSetupScriptHash(ctx context.Context) (string, error) {
+	c, err := d.apiClient.ContainerCreate(ctx, &container.Config{
+		Image: workspaceImageName + ":latest",
+	}, nil, nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to read setup scripts: %w", err)
+	}
+	defer d.apiClient.ContainerRemove(context.Background(), c.ID, container.RemoveOptions{Force: true})
+
+	reader, _, err := d.apiClient.CopyFromContainer(ctx, c.ID, "/oem")
+	if err != nil {
+		return "", fmt.Errorf("failed to read setup scripts: %w", err)
+	}
+	defer reader.Close()
+
+	files := map[string][]byte{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read setup scripts: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return "", fmt.Errorf("failed to read setup scripts: %w", err)
+		}
+		files[header.Name] = content
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		hash.Write([]byte(name))
+		hash.Write(files[name])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// runHelperContainer runs a shell command in a short lived container of the workspace image and returns its exit code.
+// The output of the command is written to output if it is not nil.
+func (d *DockerClient) runHelperContainer(ctx context.Context, mounts []mount.Mount, cmd string, output io.Writer) (int64, error) {
+	c, err := d.apiClient.ContainerCreate(ctx, &container.Config{
+		Image:      workspaceImageName + ":latest",
+		User:       "root",
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{cmd},
+	}, &container.HostConfig{
+		Mounts: mounts,
+	}, nil, nil, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create helper container: %w", err)
+	}
+	defer d.apiClient.ContainerRemove(context.Background(), c.ID, container.RemoveOptions{Force: true})
+
+	statusChan, errChan := d.apiClient.ContainerWait(ctx, c.ID, container.WaitConditionNextExit)
+
+	err = d.apiClient.ContainerStart(ctx, c.ID, container.StartOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start helper container: %w", err)
+	}
+
+	select {
+	case err := <-errChan:
+		return 0, fmt.Errorf("failed to wait for helper container: %w", err)
+	case status := <-statusChan:
+		if status.Error != nil {
+			return 0, fmt.Errorf("helper container failed: %s", status.Error.Message)
+		}
+
+		if output != nil {
+			logs, err := d.apiClient.ContainerLogs(ctx, c.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+			if err != nil {
+				return 0, fmt.Errorf("failed to get helper container output: %w", err)
+			}
+			defer logs.Close()
+
+			_, err = stdcopy.StdCopy(output, output, logs)
+			if err != nil {
+				return 0, fmt.Errorf("failed to read helper container output: %w", err)
+			}
+		}
+
+		return status.StatusCode, nil
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/daytonaio/daytona/pkg/ssh"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/errdefs"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// hostMountPath is where helper containers mount the directory of the Docker host they work on.
+const hostMountPath = "/host"
+
+// validateHost makes sure the Docker host is reachable and able to run Windows VMs.
+func (d *DockerClient) validateHost(ctx context.Context, logWriter io.Writer, sshClient *ssh.Client) error {
+	_, err := d.apiClient.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reach Docker host: %w", err)
+	}
+
+	info, err := d.apiClient.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Docker host info: %w", err)
+	}
+
+	if info.OSType != "linux" {
+		return fmt.Errorf("unsupported Docker host OS type %q: Windows workspaces require a Linux host", info.OSType)
+	}
+
+	engine, err := d.getContainerEngine(ctx)
+	if err != nil {
+		return err
+	}
+	if engine.Podman && logWriter != nil {
+		logWriter.Write([]byte(fmt.Sprintf("Using %s engine %s\n", engine, info.ServerVersion)))
+	}
+
+	for _, device := range []string{"/dev/kvm", "/dev/net/tun"} {
+		exists, err := d.hostPathExists(device, sshClient)
+		if err != nil {
+			return fmt.Errorf("failed to check %s on Docker host: %w", device, err)
+		}
+		if !exists && logWriter != nil {
+			logWriter.Write([]byte(fmt.Sprintf("Warning: %s not found on Docker host. Windows workspaces may fail to boot or run slowly.\n", device)))
+		}
+	}
+
+	return nil
+}
+
+// The host helpers below access the filesystem of the Docker host over SSH if sshClient is set, directly if the
+// host is local and otherwise, e.g. for hosts reached over TCP, through a helper container mounting the parent
+// directory of the path.
+
+func (d *DockerClient) hostPathExists(hostPath string, sshClient *ssh.Client) (bool, error) {
+	if sshClient == nil && !d.targetOptions.IsLocal() {
+		exitCode, err := d.runOnHost(path.Dir(hostPath), false, fmt.Sprintf("test -e %s", shellQuote(getHelperPath(hostPath))), nil)
+		if err != nil {
+			return false, err
+		}
+		return exitCode == 0, nil
+	}
+
+	if sshClient == nil {
+		_, err := os.Stat(hostPath)
+		if err == nil {
+			return true, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	err := sshClient.Exec(fmt.Sprintf("test -e %s", shellQuote(hostPath)), nil)
+	if err == nil {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// hostFreeDisk returns the free disk space in bytes of the filesystem holding hostPath.
+func (d *DockerClient) hostFreeDisk(hostPath string, sshClient *ssh.Client) (uint64, error) {
+	var output []byte
+	var err error
+	if sshClient == nil && !d.targetOptions.IsLocal() {
+		var buf bytes.Buffer
+		var exitCode int64
+		exitCode, err = d.runOnHost(path.Dir(hostPath), false, fmt.Sprintf("df -Pk -- %s", shellQuote(getHelperPath(hostPath))), &buf)
+		if err == nil && exitCode != 0 {
+			err = fmt.Errorf("df exited with code %d: %s", exitCode, buf.String())
+		}
+		output = buf.Bytes()
+	} else if sshClient == nil {
+		output, err = exec.Command("df", "-Pk", "--", hostPath).Output()
+	} else {
+		var session *gossh.Session
+		session, err = sshClient.NewSession()
+		if err != nil {
+			return 0, err
+		}
+		defer session.Close()
+		output, err = session.Output(fmt.Sprintf("df -Pk -- %s", shellQuote(hostPath)))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected df output: %s", string(output))
+	}
+
+	availableKb, err := strconv.ParseUint(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output: %w", err)
+	}
+
+	return availableKb * 1024, nil
+}
+
+func (d *DockerClient) mkdirOnHost(hostPath string, sshClient *ssh.Client) error {
+	if sshClient == nil && !d.targetOptions.IsLocal() {
+		return d.runOnHostOrFail(path.Dir(hostPath), true, fmt.Sprintf("mkdir -p -- %s", shellQuote(getHelperPath(hostPath))))
+	}
+
+	if sshClient == nil {
+		return os.MkdirAll(hostPath, 0755)
+	}
+
+	return sshClient.Exec(fmt.Sprintf("mkdir -p -- %s", shellQuote(hostPath)), nil)
+}
+
+func (d *DockerClient) removeFromHost(hostPath string, sshClient *ssh.Client) error {
+	if cleanPath := path.Clean(hostPath); hostPath == "" || cleanPath == "/" || cleanPath == "." {
+		return fmt.Errorf("refusing to remove %q from Docker host", hostPath)
+	}
+
+	if sshClient == nil && !d.targetOptions.IsLocal() {
+		return d.runOnHostOrFail(path.Dir(hostPath), false, fmt.Sprintf("rm -rf -- %s", shellQuote(getHelperPath(hostPath))))
+	}
+
+	if sshClient == nil {
+		return os.RemoveAll(hostPath)
+	}
+
+	return sshClient.Exec(fmt.Sprintf("rm -rf -- %s", shellQuote(hostPath)), nil)
+}
+
+// runOnHost runs a shell command in a helper container with the directory hostDir of the Docker host mounted at
+// hostMountPath. hostDir is created first if createDir is set.
+func (d *DockerClient) runOnHost(hostDir string, createDir bool, cmd string, output io.Writer) (int64, error) {
+	ctx := context.Background()
+
+	_, _, err := d.apiClient.ImageInspectWithRaw(ctx, workspaceImageName+":latest")
+	if err != nil {
+		if !errdefs.IsNotFound(err) {
+			return 0, err
+		}
+
+		err = d.PullImage(workspaceImageName, nil, io.Discard)
+		if err != nil {
+			return 0, fmt.Errorf("failed to pull helper image: %w", err)
+		}
+	}
+
+	return d.runHelperContainer(ctx, []mount.Mount{
+		{
+			Type:   mount.TypeBind,
+			Source: hostDir,
+			Target: hostMountPath,
+			BindOptions: &mount.BindOptions{
+				CreateMountpoint: createDir,
+			},
+		},
+	}, cmd, output)
+}
+
+func (d *DockerClient) runOnHostOrFail(hostDir string, createDir bool, cmd string) error {
+	var output bytes.Buffer
+	exitCode, err := d.runOnHost(hostDir, createDir, cmd, &output)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%s exited with code %d: %s", cmd, exitCode, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
+
+// getHelperPath returns the path of hostPath in a helper container run by runOnHost for its parent directory.
+func getHelperPath(hostPath string) string {
+	return path.Join(hostMountPath, path.Base(hostPath))
+}
+
+// shellQuote quotes s as a single word for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -7,13 +7,88 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
+	provider_types "github.com/daytonaio/daytona-provider-windows/pkg/types"
 	"github.com/daytonaio/daytona/pkg/models"
+	"github.com/daytonaio/daytona/pkg/ssh"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	log "github.com/sirupsen/logrus"
 )
 
-func (d *DockerClient) GetTargetProviderMetadata(t *models.Target) (string, error) {
-	return "", nil
+func (d *DockerClient) GetTargetProviderMetadata(t *models.Target, targetDir string, sshClient *ssh.Client) (string, error) {
+	ctx := context.Background()
+
+	info, err := d.apiClient.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	targetMetadata := provider_types.TargetMetadata{
+		DockerVersion: info.ServerVersion,
+		Cpus:          info.NCPU,
+		MemoryTotal:   info.MemTotal,
+	}
+
+	targetMetadata.KvmAvailable, err = d.hostPathExists("/dev/kvm", sshClient)
+	if err != nil {
+		return "", err
+	}
+
+	targetMetadata.TunAvailable, err = d.hostPathExists("/dev/net/tun", sshClient)
+	if err != nil {
+		return "", err
+	}
+
+	targetMetadata.DataDirFreeDisk, err = d.hostFreeDisk(targetDir, sshClient)
+	if err != nil {
+		log.Warnf("failed to get free disk space of %s: %v", targetDir, err)
+	}
+
+	containers, err := d.apiClient.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "daytona.workspace.id"),
+			filters.Arg("label", fmt.Sprintf("daytona.target.id=%s", t.Id)),
+		),
+		All: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range containers {
+		if c.State == "running" {
+			targetMetadata.RunningWorkspaces++
+		} else {
+			targetMetadata.StoppedWorkspaces++
+		}
+	}
+
+	images, err := d.apiClient.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", workspaceImageName)),
+	})
+	if err != nil {
+		return "", err
+	}
+	targetMetadata.ImageCached = len(images) > 0
+
+	goldenImages, err := d.ListGoldenImages()
+	if err != nil {
+		return "", err
+	}
+	for _, g := range goldenImages {
+		targetMetadata.GoldenImages = append(targetMetadata.GoldenImages, g.VolumeName)
+	}
+
+	metadata, err := json.Marshal(targetMetadata)
+	if err != nil {
+		return "", err
+	}
+
+	return string(metadata), nil
 }
 
 func (d *DockerClient) GetWorkspaceProviderMetadata(w *models.Workspace) (string, error) {
@@ -28,7 +103,17 @@ func (d *DockerClient) GetWorkspaceProviderMetadata(w *models.Workspace) (string
 
 	info.Config.Labels["remote-os"] = "windows"
 
-	metadata, err := json.Marshal(info.Config.Labels)
+	workspaceMetadata := provider_types.WorkspaceMetadata{
+		Labels: info.Config.Labels,
+	}
+
+	if info.NetworkSettings != nil {
+		if endpoint, ok := info.NetworkSettings.Networks[d.GetTargetNetworkName(w.TargetId)]; ok && endpoint != nil {
+			workspaceMetadata.NetworkId = endpoint.NetworkID
+		}
+	}
+
+	metadata, err := json.Marshal(workspaceMetadata)
 	if err != nil {
 		return "", err
 	}
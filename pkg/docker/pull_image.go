@@ -16,6 +16,7 @@ import (
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/pkg/jsonmessage"
+	log "github.com/sirupsen/logrus"
 )
 
 func (d *DockerClient) PullImage(imageName string, cr *models.ContainerRegistry, logWriter io.Writer) error {
@@ -53,6 +54,8 @@ func (d *DockerClient) PullImage(imageName string, cr *models.ContainerRegistry,
 		}
 	}
 
+	previousImageId := d.getImageId(ctx, imageName)
+
 	if logWriter != nil {
 		logWriter.Write([]byte("Pulling image...\n"))
 	}
@@ -72,9 +75,28 @@ func (d *DockerClient) PullImage(imageName string, cr *models.ContainerRegistry,
 		logWriter.Write([]byte(views.GetPrettyLogLine("Image pulled successfully")))
 	}
 
+	// Golden images built from the setup scripts of a previous workspace image are no longer used for new workspaces
+	imageUpdated := d.getImageId(ctx, imageName) != previousImageId
+	if imageUpdated && strings.HasPrefix(imageName, workspaceImageName) && d.isGoldenImageCacheEnabled() {
+		err = d.PruneGoldenImages(logWriter)
+		if err != nil {
+			log.Warnf("failed to prune golden images: %v", err)
+		}
+	}
+
 	return nil
 }
 
+// getImageId returns the ID of the local image imageName refers to, or an empty string if it does not exist.
+func (d *DockerClient) getImageId(ctx context.Context, imageName string) string {
+	inspect, _, err := d.apiClient.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return ""
+	}
+
+	return inspect.ID
+}
+
 func getRegistryAuth(cr *models.ContainerRegistry) string {
 	if cr == nil {
 		// Sometimes registry auth fails if "" is sent, so sending "empty" instead
@@ -0,0 +1,69 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// qemuMonitorPort is the port the image serves the QEMU human monitor on inside the container.
+const qemuMonitorPort = 7100
+
+// runQemuMonitorCommand runs a command on the QEMU monitor of the VM in the workspace container and returns
+// the output of the monitor.
+func (d *DockerClient) runQemuMonitorCommand(ctx context.Context, containerId, command string) (string, error) {
+	if strings.ContainsAny(command, "'\n") {
+		return "", fmt.Errorf("invalid QEMU monitor command %q", command)
+	}
+
+	exitCode, output, err := d.execInContainer(ctx, containerId, []string{
+		"/bin/sh", "-c", fmt.Sprintf("echo '%s' | nc -q 1 -w 1 localhost %d", command, qemuMonitorPort),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to run QEMU monitor command %s: %w", command, err)
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("failed to run QEMU monitor command %s: exited with code %d: %s", command, exitCode, strings.TrimSpace(output))
+	}
+
+	return output, nil
+}
+
+// execInContainer runs cmd in the running container and returns its exit code and combined output.
+func (d *DockerClient) execInContainer(ctx context.Context, containerId string, cmd []string) (int, string, error) {
+	exec, err := d.apiClient.ContainerExecCreate(ctx, containerId, container.ExecOptions{
+		User:         "root",
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	resp, err := d.apiClient.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Close()
+
+	var output bytes.Buffer
+	_, err = stdcopy.StdCopy(&output, &output, resp.Reader)
+	if err != nil {
+		return 0, "", err
+	}
+
+	inspect, err := d.apiClient.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return inspect.ExitCode, output.String(), nil
+}
@@ -6,10 +6,24 @@ package docker
 import (
 	"context"
 	"fmt"
+	"io"
 
+	"github.com/daytonaio/daytona/pkg/models"
+	"github.com/daytonaio/daytona/pkg/ssh"
 	"github.com/docker/docker/api/types/container"
 )
 
+func (d *DockerClient) StartTarget(target *models.Target, targetDir string, logWriter io.Writer, sshClient *ssh.Client) error {
+	ctx := context.Background()
+
+	err := d.validateHost(ctx, logWriter, sshClient)
+	if err != nil {
+		return err
+	}
+
+	return d.createTargetResources(ctx, target, targetDir, logWriter, sshClient)
+}
+
 func (d *DockerClient) StartWorkspace(opts *CreateWorkspaceOptions, daytonaDownloadUrl string) error {
 	containerName := d.GetWorkspaceContainerName(opts.Workspace)
 	c, err := d.apiClient.ContainerInspect(context.TODO(), containerName)
@@ -17,19 +31,50 @@ func (d *DockerClient) StartWorkspace(opts *CreateWorkspaceOptions, daytonaDownl
 		return fmt.Errorf("failed to inspect container when starting project: %w", err)
 	}
 
-	if !c.State.Running {
-		err = d.apiClient.ContainerStart(context.TODO(), containerName, container.StartOptions{})
+	resumed := false
+	if !c.State.Running && c.Config.Labels[suspendedLabel] != "" {
+		c, resumed, err = d.resumeWorkspace(context.TODO(), c, opts.LogWriter)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !c.State.Running && !resumed {
+		// A failed restore replaces the container, which is started by its ID
+		err = d.apiClient.ContainerStart(context.TODO(), c.ID, container.StartOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to start container: %w", err)
 		}
 
-		d.OpenWebUI(d.targetOptions.RemoteHostname, c,opts.LogWriter)
+		d.OpenWebUI(d.targetOptions.GetHostname(), c, opts.LogWriter)
 
-		err = d.WaitForWindowsBoot(c.ID, d.targetOptions.RemoteHostname)
+		err = d.WaitForWindowsBoot(c.ID, d.targetOptions.GetHostname(), opts.LogWriter, false)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	c, err = d.apiClient.ContainerInspect(context.TODO(), c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container when starting project: %w", err)
+	}
+
+	// The agent of a restored VM kept running
+	if resumed {
+		return d.WaitForWindowsBoot(c.ID, d.targetOptions.GetHostname(), opts.LogWriter, true)
+	}
+
+	sshClient, err := d.GetSshClient(d.targetOptions.GetHostname(), c)
+	if err != nil {
+		return fmt.Errorf("failed to get SSH client: %w", err)
+	}
+	defer sshClient.Close()
+
+	// The agent is reinstalled in case the server was upgraded since the workspace was created
+	err = d.installDaytonaAgent(opts.Workspace, opts.WorkspaceDir, daytonaDownloadUrl, opts.LogWriter, sshClient)
+	if err != nil {
+		return err
+	}
+
+	return d.WaitForWindowsBoot(c.ID, d.targetOptions.GetHostname(), opts.LogWriter, true)
 }
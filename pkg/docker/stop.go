@@ -5,46 +5,177 @@ package docker
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/daytonaio/daytona/pkg/models"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"golang.org/x/crypto/ssh"
 )
 
+func (d *DockerClient) StopTarget(target *models.Target, logWriter io.Writer) error {
+	ctx := context.Background()
+
+	containers, err := d.apiClient.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("daytona.target.id=%s", target.Id))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list target containers: %w", err)
+	}
+
+	for _, c := range containers {
+		logWriter.Write([]byte(fmt.Sprintf("Stopping container %s\n", c.ID)))
+
+		err = d.apiClient.ContainerStop(ctx, c.ID, container.StopOptions{
+			Timeout: &[]int{workspaceStopTimeout}[0],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to stop container %s: %w", c.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// StopWorkspace shuts Windows down over SSH, or with an ACPI powerdown if SSH is not available, and waits for
+// the container to exit after the VM powered off. The container is only stopped forcibly after the shutdown timeout.
+// If the target suspends workspaces, the VM is suspended instead and only shut down if that fails.
 func (d *DockerClient) StopWorkspace(workspace *models.Workspace, logWriter io.Writer) error {
+	ctx := context.Background()
+
 	containerName := d.GetWorkspaceContainerName(workspace)
-	c, err := d.apiClient.ContainerInspect(context.TODO(), containerName)
+	c, err := d.apiClient.ContainerInspect(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container when stopping workspace: %w", err)
+	}
+
+	if !c.State.Running {
+		logWriter.Write([]byte("Workspace container is not running\n"))
+		return nil
+	}
+
+	if d.targetOptions.SuspendOnStop != nil && *d.targetOptions.SuspendOnStop {
+		err = d.suspendWorkspace(ctx, c, logWriter)
+		if err == nil {
+			return nil
+		}
+		logWriter.Write([]byte(fmt.Sprintf("Failed to suspend Windows: %s. Shutting down instead\n", err)))
+	}
+
+	err = d.shutdownWorkspace(ctx, c, logWriter)
 	if err != nil {
 		return err
 	}
 
-	sshClient, err := d.GetSshClient(d.targetOptions.RemoteHostname, c)
+	// A container restored from a suspended VM would try to restore it again on the next start
+	if c.Config.Labels[suspendedLabel] != "" {
+		_, err = d.recreateWorkspaceContainer(ctx, c, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shutdownWorkspace shuts the VM of the running container down and makes sure the container exits.
+func (d *DockerClient) shutdownWorkspace(ctx context.Context, c types.ContainerJSON, logWriter io.Writer) error {
+	timeout := time.Duration(workspaceStopTimeout) * time.Second
+	if d.targetOptions.ShutdownTimeout != nil && *d.targetOptions.ShutdownTimeout > 0 {
+		timeout = time.Duration(*d.targetOptions.ShutdownTimeout) * time.Second
+	}
+
+	err := d.shutdownWindows(c, logWriter)
+	if err != nil {
+		logWriter.Write([]byte(fmt.Sprintf("Failed to shut down Windows over SSH: %s\n", err)))
+		logWriter.Write([]byte("Sending ACPI powerdown to the VM\n"))
+
+		_, err = d.runQemuMonitorCommand(ctx, c.ID, "system_powerdown")
+		if err != nil {
+			logWriter.Write([]byte(fmt.Sprintf("Failed to send ACPI powerdown: %s\n", err)))
+		}
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Waiting up to %s for Windows to shut down\n", timeout)))
+
+	exited, err := d.waitForContainerExit(ctx, c.ID, timeout)
 	if err != nil {
 		return err
 	}
+	if exited {
+		logWriter.Write([]byte("Windows shut down, workspace container stopped\n"))
+		return nil
+	}
+
+	logWriter.Write([]byte("Windows did not shut down in time, stopping the workspace container\n"))
 
-	err = d.ExecuteCommand("sudo shutdown -h now", logWriter, sshClient)
+	err = d.apiClient.ContainerStop(ctx, c.ID, container.StopOptions{
+		Timeout: &[]int{10}[0],
+	})
 	if err == nil {
+		logWriter.Write([]byte("Workspace container stopped\n"))
 		return nil
 	}
 
-	time.Sleep(time.Second * 2)
+	logWriter.Write([]byte(fmt.Sprintf("Failed to stop the workspace container: %s, killing it\n", err)))
 
-	for i := 0; i < 6; i++ {
-		client, err := d.GetSshClient(d.targetOptions.RemoteHostname,c)
-		if err != nil {
-			return nil
-		}
-		client.Close()
-		time.Sleep(time.Millisecond * 500)
-		i++
+	err = d.apiClient.ContainerKill(ctx, c.ID, "SIGKILL")
+	if err != nil {
+		return fmt.Errorf("failed to kill container %s: %w", c.ID, err)
 	}
 
-	err = d.apiClient.ContainerKill(context.TODO(), d.GetWorkspaceContainerName(workspace), "SIGKILL")
+	logWriter.Write([]byte("Workspace container killed\n"))
+
+	return nil
+}
+
+// shutdownWindows starts a shutdown of Windows over SSH.
+func (d *DockerClient) shutdownWindows(c types.ContainerJSON, logWriter io.Writer) error {
+	sshClient, err := d.GetSshClient(d.targetOptions.GetHostname(), c)
 	if err != nil {
 		return err
 	}
+	defer sshClient.Close()
+
+	logWriter.Write([]byte("Shutting down Windows\n"))
+
+	result, err := d.ExecInVm(context.Background(), sshClient, VmExecOptions{
+		Command: "shutdown /s /t 0",
+	})
+	// The connection may be closed by the shutdown before the exit code is sent
+	var exitMissingErr *ssh.ExitMissingError
+	if errors.As(err, &exitMissingErr) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("shutdown exited with code %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
 
 	return nil
+}
+
+// waitForContainerExit returns whether the container exited within the timeout.
+func (d *DockerClient) waitForContainerExit(ctx context.Context, containerId string, timeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
+	statusChan, errChan := d.apiClient.ContainerWait(ctx, containerId, container.WaitConditionNotRunning)
+
+	select {
+	case <-statusChan:
+		return true, nil
+	case err := <-errChan:
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to wait for container %s: %w", containerId, err)
+	}
 }
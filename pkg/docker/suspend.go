@@ -0,0 +1,339 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	log "github.com/sirupsen/logrus"
+)
+
+// vmResumedMarkerPath is touched on the workspace volume whenever a VM was restored. Older states no longer match
+// the disk of the VM.
+const vmResumedMarkerPath = vmStoragePath + "/daytona.resumed"
+
+// suspendedLabel marks workspace containers that restore their VM from the saved state when started. Its value is
+// the name of the state file on the workspace volume.
+const suspendedLabel = "daytona.suspended"
+
+var vmStateNameRegex = regexp.MustCompile(`^daytona-[0-9]+\.vmstate$`)
+
+// vmResumeArgumentsRegex matches the QEMU arguments restoring the VM from a saved state instead of booting it.
+var vmResumeArgumentsRegex = regexp.MustCompile(` -incoming file:\S+$`)
+
+const (
+	suspendTimeout = 10 * time.Minute
+	resumeTimeout  = 5 * time.Minute
+)
+
+// suspendWorkspace saves the memory state of the VM to the workspace volume, stops the container and replaces it
+// with a container restoring the VM on start. The VM keeps running if its state can not be saved.
+func (d *DockerClient) suspendWorkspace(ctx context.Context, c types.ContainerJSON, logWriter io.Writer) error {
+	logWriter.Write([]byte("Suspending Windows\n"))
+
+	_, err := d.runQemuMonitorCommand(ctx, c.ID, "stop")
+	if err != nil {
+		return err
+	}
+
+	// Every suspend gets a state of its own, so a container can't restore the state of an earlier suspend
+	stateName := fmt.Sprintf("daytona-%d.vmstate", time.Now().UnixNano())
+	statePath := getVmStatePath(stateName)
+
+	err = d.saveVmState(ctx, c.ID, statePath, logWriter)
+	if err != nil {
+		// The state is incomplete, the VM is resumed so it can be shut down
+		d.execInContainer(ctx, c.ID, []string{"rm", "-f", statePath + ".tmp"})
+		_, contErr := d.runQemuMonitorCommand(ctx, c.ID, "cont")
+		return errors.Join(err, contErr)
+	}
+
+	// QEMU exits without shutting down the paused VM, which makes the container exit
+	_, err = d.runQemuMonitorCommand(ctx, c.ID, "quit")
+	if err != nil {
+		return fmt.Errorf("failed to stop the suspended VM: %w", err)
+	}
+
+	exited, err := d.waitForContainerExit(ctx, c.ID, time.Duration(workspaceStopTimeout)*time.Second)
+	if err != nil {
+		return err
+	}
+	if !exited {
+		err = d.apiClient.ContainerKill(ctx, c.ID, "SIGKILL")
+		if err != nil {
+			return fmt.Errorf("failed to kill container %s: %w", c.ID, err)
+		}
+	}
+
+	_, err = d.recreateWorkspaceContainer(ctx, c, stateName)
+	if err != nil {
+		return err
+	}
+
+	logWriter.Write([]byte("Windows suspended\n"))
+
+	return nil
+}
+
+// saveVmState migrates the paused VM to the state file statePath on the workspace volume.
+func (d *DockerClient) saveVmState(ctx context.Context, containerId, statePath string, logWriter io.Writer) error {
+	_, err := d.runQemuMonitorCommand(ctx, containerId, fmt.Sprintf("migrate -d file:%s.tmp", statePath))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, suspendTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.runQemuMonitorCommand(context.Background(), containerId, "migrate_cancel")
+			return fmt.Errorf("timed out after %s saving the VM memory", suspendTimeout)
+		case <-ticker.C:
+		}
+
+		output, err := d.runQemuMonitorCommand(ctx, containerId, "info migrate")
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.Contains(output, "Migration status: completed"):
+			exitCode, output, err := d.execInContainer(ctx, containerId, []string{"mv", statePath + ".tmp", statePath})
+			if err != nil {
+				return err
+			}
+			if exitCode != 0 {
+				return fmt.Errorf("failed to store the VM memory: %s", strings.TrimSpace(output))
+			}
+			return nil
+		case strings.Contains(output, "Migration status: failed"), strings.Contains(output, "Migration status: cancelled"):
+			return fmt.Errorf("failed to save the VM memory: %s", strings.TrimSpace(output))
+		}
+
+		logWriter.Write([]byte("Saving VM memory...\n"))
+	}
+}
+
+// resumeWorkspace starts a suspended workspace container and waits until the restored VM accepts SSH connections.
+// It returns the container to cold boot with if the VM could not be restored. States older than the last resume
+// are not restored, as the disk changed since.
+//
+// The running container keeps the arguments restoring the state, they can only be changed by recreating it. The state
+// is removed and the resume is recorded instead, so the container can't restore it again. The container is replaced
+// when the workspace is stopped, or when it is started again after the VM exited.
+func (d *DockerClient) resumeWorkspace(ctx context.Context, c types.ContainerJSON, logWriter io.Writer) (types.ContainerJSON, bool, error) {
+	stateName := c.Config.Labels[suspendedLabel]
+	statePath := getVmStatePath(stateName)
+
+	logWriter.Write([]byte("Restoring suspended Windows\n"))
+
+	err := d.checkVmState(ctx, c, stateName)
+	if err == nil {
+		err = d.restoreVm(ctx, c)
+	}
+	if err == nil {
+		// The state only matches the disk until the VM runs again
+		err = d.discardVmState(ctx, c.ID, statePath)
+		if err != nil {
+			return c, true, err
+		}
+		logWriter.Write([]byte("Windows restored\n"))
+		return c, true, nil
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Failed to restore Windows: %s. Booting Windows instead\n", err)))
+
+	err = d.apiClient.ContainerKill(ctx, c.ID, "SIGKILL")
+	if err != nil && !errdefs.IsConflict(err) {
+		log.Debugf("failed to kill container %s: %v", c.ID, err)
+	}
+
+	coldBoot, err := d.recreateWorkspaceContainer(ctx, c, "")
+	if err != nil {
+		return c, false, fmt.Errorf("failed to recreate the workspace container: %w", err)
+	}
+
+	if !vmStateNameRegex.MatchString(stateName) {
+		return coldBoot, false, nil
+	}
+
+	// The volume still holds the state of the failed restore
+	err = d.runVolumeCommand(ctx, coldBoot, fmt.Sprintf("rm -f -- %s", shellQuote(statePath)))
+	if err != nil {
+		logWriter.Write([]byte(fmt.Sprintf("WARNING: Failed to remove the saved state %s from the workspace volume: %s\n", statePath, err)))
+	}
+
+	return coldBoot, false, nil
+}
+
+// checkVmState makes sure the state stateName exists and was saved after the last resume of the VM.
+func (d *DockerClient) checkVmState(ctx context.Context, c types.ContainerJSON, stateName string) error {
+	if !vmStateNameRegex.MatchString(stateName) {
+		return fmt.Errorf("invalid state name %q", stateName)
+	}
+
+	state, marker := shellQuote(getVmStatePath(stateName)), shellQuote(vmResumedMarkerPath)
+	cmd := fmt.Sprintf(
+		"if [ ! -f %s ]; then echo 'the saved state does not exist'; exit 1; fi; "+
+			"if [ -e %s ] && [ ! %s -nt %s ]; then echo 'the saved state predates the last resume'; exit 1; fi",
+		state, marker, state, marker)
+
+	var output bytes.Buffer
+	exitCode, err := d.runHelperContainer(ctx, c.HostConfig.Mounts, cmd, &output)
+	if err != nil {
+		return fmt.Errorf("failed to check the saved state: %w", err)
+	}
+	if exitCode != 0 {
+		return errors.New(strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
+
+// discardVmState records the resume of the VM in the running container and removes the restored state.
+func (d *DockerClient) discardVmState(ctx context.Context, containerId, statePath string) error {
+	// The resume is recorded first, so the state is refused even if it can't be removed
+	exitCode, output, err := d.execInContainer(ctx, containerId, []string{"touch", vmResumedMarkerPath})
+	if err == nil && exitCode != 0 {
+		err = errors.New(strings.TrimSpace(output))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the resume of the VM, stop the workspace before starting it again: %w", err)
+	}
+
+	exitCode, output, err = d.execInContainer(ctx, containerId, []string{"rm", "-f", "--", statePath})
+	if err == nil && exitCode != 0 {
+		err = errors.New(strings.TrimSpace(output))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove the restored state %s: %w", statePath, err)
+	}
+
+	return nil
+}
+
+func (d *DockerClient) restoreVm(ctx context.Context, c types.ContainerJSON) error {
+	err := d.apiClient.ContainerStart(ctx, c.ID, container.StartOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resumeTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s", resumeTimeout)
+		case <-ticker.C:
+		}
+
+		current, err := d.apiClient.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if !current.State.Running {
+			return fmt.Errorf("container exited with exit code %d", current.State.ExitCode)
+		}
+
+		sshClient, err := d.GetSshClient(d.targetOptions.GetHostname(), current)
+		if err == nil {
+			sshClient.Close()
+			return nil
+		}
+	}
+}
+
+// recreateWorkspaceContainer replaces the stopped workspace container with a container of the same configuration
+// whose VM is restored from the state stateName if it is set and booted otherwise.
+func (d *DockerClient) recreateWorkspaceContainer(ctx context.Context, c types.ContainerJSON, stateName string) (types.ContainerJSON, error) {
+	config := *c.Config
+	config.Labels = map[string]string{}
+	for key, value := range c.Config.Labels {
+		config.Labels[key] = value
+	}
+	delete(config.Labels, suspendedLabel)
+	if stateName != "" {
+		config.Labels[suspendedLabel] = stateName
+	}
+
+	config.Env = nil
+	for _, env := range c.Config.Env {
+		if strings.HasPrefix(env, "ARGUMENTS=") {
+			env = "ARGUMENTS=" + getVmArguments(strings.TrimPrefix(env, "ARGUMENTS="), stateName)
+		}
+		config.Env = append(config.Env, env)
+	}
+
+	endpoints := map[string]*network.EndpointSettings{}
+	for name, endpoint := range c.NetworkSettings.Networks {
+		endpoints[name] = &network.EndpointSettings{
+			NetworkID: endpoint.NetworkID,
+			Aliases:   endpoint.Aliases,
+		}
+	}
+
+	err := d.apiClient.ContainerRemove(ctx, c.ID, container.RemoveOptions{})
+	if err != nil {
+		return c, fmt.Errorf("failed to remove container: %w", err)
+	}
+
+	created, err := d.apiClient.ContainerCreate(ctx, &config, c.HostConfig, &network.NetworkingConfig{
+		EndpointsConfig: endpoints,
+	}, nil, strings.TrimPrefix(c.Name, "/"))
+	if err != nil {
+		return c, fmt.Errorf("failed to create container: %w", err)
+	}
+
+	return d.apiClient.ContainerInspect(ctx, created.ID)
+}
+
+// runVolumeCommand runs a shell command in a helper container with the volumes of the stopped container c.
+func (d *DockerClient) runVolumeCommand(ctx context.Context, c types.ContainerJSON, cmd string) error {
+	exitCode, err := d.runHelperContainer(ctx, c.HostConfig.Mounts, cmd, nil)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%s exited with code %d", cmd, exitCode)
+	}
+
+	return nil
+}
+
+// getVmArguments returns the QEMU arguments restoring the VM from the state stateName if it is set and booting it
+// otherwise.
+func getVmArguments(arguments, stateName string) string {
+	arguments = vmResumeArgumentsRegex.ReplaceAllString(arguments, "")
+	if stateName != "" {
+		arguments += " -incoming file:" + getVmStatePath(stateName)
+	}
+
+	return arguments
+}
+
+// getVmStatePath returns the path of the state stateName on the workspace volume.
+func getVmStatePath(stateName string) string {
+	return path.Join(vmStoragePath, stateName)
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import "testing"
+
+func TestGetVmArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments string
+		stateName string
+		want      string
+	}{
+		{"boot", "-device x", "", "-device x"},
+		{"suspend", "-device x", "daytona-1.vmstate", "-device x -incoming file:/storage/daytona-1.vmstate"},
+		{"suspend again", "-device x -incoming file:/storage/daytona-1.vmstate", "daytona-2.vmstate", "-device x -incoming file:/storage/daytona-2.vmstate"},
+		{"boot after suspend", "-device x -incoming file:/storage/daytona-1.vmstate", "", "-device x"},
+		{"empty", "", "daytona-1.vmstate", " -incoming file:/storage/daytona-1.vmstate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getVmArguments(tt.arguments, tt.stateName)
+			if got != tt.want {
+				t.Errorf("getVmArguments(%q, %q) = %q, want %q", tt.arguments, tt.stateName, got, tt.want)
+			}
+		})
+	}
+}
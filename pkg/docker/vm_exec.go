@@ -0,0 +1,235 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-windows/pkg/windows_quote"
+	"golang.org/x/crypto/ssh"
+)
+
+// VmShell is the shell a command is run with in the VM.
+type VmShell string
+
+const (
+	VmShellCmd        VmShell = "cmd"
+	VmShellPowerShell VmShell = "powershell"
+	VmShellGitBash    VmShell = "git-bash"
+)
+
+const vmGitBashPath = "C:\\Program Files\\Git\\bin\\bash.exe"
+
+// readStdinScript is the PowerShell script running the script passed on stdin.
+const readStdinScript = "[Console]::In.ReadToEnd() | Invoke-Expression"
+
+// vmExecIdVariable is set to a unique id for every command run by ExecInVm. The id is part of the command line
+// of the cmd.exe process OpenSSH starts for the command, which identifies its process tree.
+const vmExecIdVariable = "DAYTONA_EXEC_ID"
+
+const vmKillTimeout = 30 * time.Second
+
+type VmExecOptions struct {
+	// Command is run by Shell. For VmShellCmd it is a cmd.exe command line, which can be built with windows_quote.
+	Command string
+	// Shell defaults to VmShellCmd
+	Shell VmShell
+	// Env is set for the command in addition to the environment of the VM user
+	Env map[string]string
+	// Stdin, if set, is the input of the command. Otherwise PowerShell and Git Bash scripts are passed on stdin,
+	// so they are not limited by the command line length limit of cmd.exe.
+	Stdin io.Reader
+	// Stdout and Stderr, if set, receive the output while the command runs. The output is returned in any case.
+	Stdout io.Writer
+	Stderr io.Writer
+	// ForwardAgent makes the ssh-agent of the provider available to the command. The agent stays reachable for
+	// every session of the connection until it is closed, so forwarded commands should use a connection of their own.
+	ForwardAgent bool
+}
+
+type VmExecResult struct {
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+}
+
+// ExecInVm runs a command in the VM over conn. A command exiting with a non-zero exit code is not an error, errors
+// are returned if the command could not be run or ctx is done before the command exits. If ctx is done, the process
+// tree of the command is killed.
+func (d *DockerClient) ExecInVm(ctx context.Context, conn *ssh.Client, opts VmExecOptions) (*VmExecResult, error) {
+	cmd, stdin, err := getVmCommandLine(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	execId, err := generateExecId()
+	if err != nil {
+		return nil, err
+	}
+	cmd = getExecCommandLine(execId, cmd)
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	if opts.ForwardAgent {
+		err = d.forwardAgent(conn, session)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = teeOutput(&stdout, opts.Stdout)
+	session.Stderr = teeOutput(&stderr, opts.Stderr)
+
+	err = session.Start(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		// OpenSSH on Windows neither forwards signals nor stops the command when the session is closed
+		killErr := killVmCommand(conn, execId)
+		session.Close()
+		return nil, errors.Join(fmt.Errorf("command did not exit in time: %w", ctx.Err()), killErr)
+	case err = <-done:
+	}
+
+	result := &VmExecResult{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitStatus()
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// killVmCommand kills the process tree of the command run by ExecInVm with execId.
+func killVmCommand(conn *ssh.Client, execId string) error {
+	session, err := conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to kill command: %w", err)
+	}
+	defer session.Close()
+
+	err = session.Start(getKillCommandLine(execId))
+	if err != nil {
+		return fmt.Errorf("failed to kill command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			return fmt.Errorf("failed to kill command: %w", err)
+		}
+		return nil
+	case <-time.After(vmKillTimeout):
+		return fmt.Errorf("failed to kill command: timed out after %s", vmKillTimeout)
+	}
+}
+
+// getExecCommandLine returns the command line running cmd with the exec id execId.
+func getExecCommandLine(execId, cmd string) string {
+	return fmt.Sprintf("set %s=%s&& %s", vmExecIdVariable, execId, cmd)
+}
+
+// getKillCommandLine returns the command line killing the process tree of the command with the exec id execId.
+// The script is encoded, so the command line doesn't contain the id and doesn't match the filter itself.
+func getKillCommandLine(execId string) string {
+	filter := fmt.Sprintf("Name = 'cmd.exe' AND CommandLine LIKE '%%%s=%s%%'", vmExecIdVariable, execId)
+	script := fmt.Sprintf("Get-CimInstance Win32_Process -Filter %s | ForEach-Object { taskkill.exe /F /T /PID $_.ProcessId }", windows_quote.PowerShell(filter))
+
+	return windows_quote.PowerShellCommand(script)
+}
+
+func generateExecId() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate exec id: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// getVmCommandLine returns the cmd.exe command line and the stdin running the command of opts.
+func getVmCommandLine(opts VmExecOptions) (string, io.Reader, error) {
+	// Every shell is started by cmd.exe, the default shell of OpenSSH on Windows, and inherits its environment
+	keys := make([]string, 0, len(opts.Env))
+	for key := range opts.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	cmd := ""
+	for _, key := range keys {
+		if key == "" || strings.Contains(key, "=") {
+			return "", nil, fmt.Errorf("invalid environment variable name %q", key)
+		}
+		variable, err := windows_quote.Cmd(fmt.Sprintf("%s=%s", key, opts.Env[key]))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value of environment variable %s: %w", key, err)
+		}
+		cmd += fmt.Sprintf("set %s&& ", variable)
+	}
+
+	switch opts.Shell {
+	case "", VmShellCmd:
+		return cmd + opts.Command, opts.Stdin, nil
+	case VmShellPowerShell:
+		if opts.Stdin == nil {
+			return cmd + windows_quote.PowerShellCommand(readStdinScript), strings.NewReader(opts.Command), nil
+		}
+		return cmd + windows_quote.PowerShellCommand(opts.Command), opts.Stdin, nil
+	case VmShellGitBash:
+		if opts.Stdin == nil {
+			bash, err := windows_quote.CmdCommand(vmGitBashPath, "-s")
+			return cmd + bash, strings.NewReader(opts.Command), err
+		}
+		bash, err := windows_quote.CmdCommand(vmGitBashPath, "-c", opts.Command)
+		return cmd + bash, opts.Stdin, err
+	default:
+		return "", nil, fmt.Errorf("unsupported shell %q", opts.Shell)
+	}
+}
+
+func teeOutput(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+
+	return io.MultiWriter(buf, w)
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-windows/pkg/windows_quote"
+)
+
+func TestGetVmCommandLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      VmExecOptions
+		wantCmd   string
+		wantStdin string
+		wantErr   bool
+	}{
+		{
+			name:    "cmd",
+			opts:    VmExecOptions{Command: "whoami"},
+			wantCmd: "whoami",
+		},
+		{
+			name:      "cmd with stdin",
+			opts:      VmExecOptions{Command: "more", Shell: VmShellCmd, Stdin: strings.NewReader("input")},
+			wantCmd:   "more",
+			wantStdin: "input",
+		},
+		{
+			name: "sorted env",
+			opts: VmExecOptions{
+				Command: "whoami",
+				Env:     map[string]string{"B": "2", "A": "1"},
+			},
+			wantCmd: "set A=1&& set B=2&& whoami",
+		},
+		{
+			name: "env metacharacters",
+			opts: VmExecOptions{
+				Command: "whoami",
+				Env:     map[string]string{"K": `"a&b|c<d>e^f(g)h!i %PATH%"`},
+			},
+			wantCmd: `set K=^"a^&b^|c^<d^>e^^f^(g^)h^!i ^%PATH^%^"&& whoami`,
+		},
+		{
+			name: "env newline",
+			opts: VmExecOptions{
+				Command: "whoami",
+				Env:     map[string]string{"K": "a\nb"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "env NUL",
+			opts: VmExecOptions{
+				Command: "whoami",
+				Env:     map[string]string{"K": "a\x00b"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty env name",
+			opts: VmExecOptions{
+				Command: "whoami",
+				Env:     map[string]string{"": "1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "env name with equals sign",
+			opts: VmExecOptions{
+				Command: "whoami",
+				Env:     map[string]string{"A=B": "1"},
+			},
+			wantErr: true,
+		},
+		{
+			name:      "powershell script on stdin",
+			opts:      VmExecOptions{Command: "Write-Output 'a&b'", Shell: VmShellPowerShell},
+			wantCmd:   windows_quote.PowerShellCommand(readStdinScript),
+			wantStdin: "Write-Output 'a&b'",
+		},
+		{
+			name:      "powershell with stdin",
+			opts:      VmExecOptions{Command: "$input", Shell: VmShellPowerShell, Stdin: strings.NewReader("input")},
+			wantCmd:   windows_quote.PowerShellCommand("$input"),
+			wantStdin: "input",
+		},
+		{
+			name:      "git bash script on stdin",
+			opts:      VmExecOptions{Command: "echo \"$HOME\" && ls", Shell: VmShellGitBash},
+			wantCmd:   `@"C:\Program Files\Git\bin\bash.exe" -s`,
+			wantStdin: "echo \"$HOME\" && ls",
+		},
+		{
+			name:      "git bash with stdin",
+			opts:      VmExecOptions{Command: `cat > "a b"`, Shell: VmShellGitBash, Stdin: strings.NewReader("input")},
+			wantCmd:   `@"C:\Program Files\Git\bin\bash.exe" -c ^"cat ^> \^"a b\^"^"`,
+			wantStdin: "input",
+		},
+		{
+			name:    "git bash with stdin and newline",
+			opts:    VmExecOptions{Command: "ls\nls", Shell: VmShellGitBash, Stdin: strings.NewReader("")},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported shell",
+			opts:    VmExecOptions{Command: "ls", Shell: "zsh"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdin, err := getVmCommandLine(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("getVmCommandLine() = %q, want an error", cmd)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getVmCommandLine() error = %v", err)
+			}
+			if cmd != tt.wantCmd {
+				t.Errorf("getVmCommandLine() = %q, want %q", cmd, tt.wantCmd)
+			}
+
+			gotStdin := ""
+			if stdin != nil {
+				b, err := io.ReadAll(stdin)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotStdin = string(b)
+			}
+			if gotStdin != tt.wantStdin {
+				t.Errorf("getVmCommandLine() stdin = %q, want %q", gotStdin, tt.wantStdin)
+			}
+		})
+	}
+}
+
+func TestGetExecCommandLine(t *testing.T) {
+	execId := "0123456789abcdef0123456789abcdef"
+
+	got := getExecCommandLine(execId, "set A=1&& whoami")
+	want := "set DAYTONA_EXEC_ID=0123456789abcdef0123456789abcdef&& set A=1&& whoami"
+	if got != want {
+		t.Errorf("getExecCommandLine() = %q, want %q", got, want)
+	}
+}
+
+func TestGetKillCommandLine(t *testing.T) {
+	execId := "0123456789abcdef0123456789abcdef"
+
+	got := getKillCommandLine(execId)
+	want := windows_quote.PowerShellCommand("Get-CimInstance Win32_Process -Filter " +
+		"'Name = ''cmd.exe'' AND CommandLine LIKE ''%DAYTONA_EXEC_ID=0123456789abcdef0123456789abcdef%''' " +
+		"| ForEach-Object { taskkill.exe /F /T /PID $_.ProcessId }")
+	if got != want {
+		t.Errorf("getKillCommandLine() = %q, want %q", got, want)
+	}
+
+	// The kill command must not match its own filter
+	if strings.Contains(got, execId) {
+		t.Errorf("getKillCommandLine() = %q contains the exec id", got)
+	}
+}
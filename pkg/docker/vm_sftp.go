@@ -0,0 +1,289 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+var windowsDrivePathRegex = regexp.MustCompile(`^[A-Za-z]:(/|$)`)
+
+// transferProgressInterval is how often the progress of a file transfer is reported.
+const transferProgressInterval = 5 * time.Second
+
+// UploadToVm copies the local file or directory src to dst in the VM over SFTP. dst is a Windows path, relative
+// paths are relative to the home directory of the VM user. Existing files are overwritten.
+func (d *DockerClient) UploadToVm(conn *ssh.Client, src, dst string, logWriter io.Writer) error {
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	defer client.Close()
+
+	remoteRoot := toSftpPath(dst)
+	var files, size int64
+
+	err = filepath.WalkDir(src, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, localPath)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(remoteRoot, filepath.ToSlash(rel))
+
+		switch {
+		case entry.IsDir():
+			err = client.MkdirAll(remotePath)
+			if err != nil {
+				return fmt.Errorf("failed to create directory %s in VM: %w", remotePath, err)
+			}
+			return nil
+		case !entry.Type().IsRegular():
+			logWriter.Write([]byte(fmt.Sprintf("Skipping %s, not a regular file\n", localPath)))
+			return nil
+		}
+
+		n, err := uploadFile(client, localPath, remotePath, logWriter)
+		if err != nil {
+			return err
+		}
+		logWriter.Write([]byte(fmt.Sprintf("Uploaded %s (%d bytes)\n", localPath, n)))
+
+		files++
+		size += n
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to VM: %w", src, err)
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Uploaded %d files (%d bytes) to %s\n", files, size, dst)))
+
+	return nil
+}
+
+// DownloadFromVm copies the file or directory src in the VM to the local path dst over SFTP. src is a Windows path,
+// relative paths are relative to the home directory of the VM user. Existing files are overwritten.
+func (d *DockerClient) DownloadFromVm(conn *ssh.Client, src, dst string, logWriter io.Writer) error {
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	defer client.Close()
+
+	remoteRoot := toSftpPath(src)
+	var files, size int64
+
+	walker := client.Walk(remoteRoot)
+	for walker.Step() {
+		err = walker.Err()
+		if err != nil {
+			return fmt.Errorf("failed to download %s from VM: %w", src, err)
+		}
+
+		rel, err := getSftpRelPath(remoteRoot, walker.Path())
+		if err != nil {
+			return fmt.Errorf("failed to download %s from VM: %w", src, err)
+		}
+		localPath := filepath.Join(dst, filepath.FromSlash(rel))
+		info := walker.Stat()
+
+		switch {
+		case info.IsDir():
+			err = os.MkdirAll(localPath, 0755)
+			if err != nil {
+				return fmt.Errorf("failed to download %s from VM: %w", src, err)
+			}
+			continue
+		case !info.Mode().IsRegular():
+			logWriter.Write([]byte(fmt.Sprintf("Skipping %s, not a regular file\n", walker.Path())))
+			continue
+		}
+
+		n, err := downloadFile(client, walker.Path(), localPath, info.Size(), logWriter)
+		if err != nil {
+			return fmt.Errorf("failed to download %s from VM: %w", src, err)
+		}
+		logWriter.Write([]byte(fmt.Sprintf("Downloaded %s (%d bytes)\n", walker.Path(), n)))
+
+		files++
+		size += n
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Downloaded %d files (%d bytes) to %s\n", files, size, dst)))
+
+	return nil
+}
+
+func uploadFile(client *sftp.Client, localPath, remotePath string, logWriter io.Writer) (int64, error) {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	err = client.MkdirAll(path.Dir(remotePath))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create directory %s in VM: %w", path.Dir(remotePath), err)
+	}
+
+	dst, err := client.Create(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s in VM: %w", remotePath, err)
+	}
+	defer dst.Close()
+
+	n, err := dst.ReadFrom(&progressReader{
+		Reader:   src,
+		progress: newTransferProgress("Uploading", localPath, info.Size(), logWriter),
+	})
+	if err != nil {
+		return n, fmt.Errorf("failed to write %s in VM: %w", remotePath, err)
+	}
+
+	return n, dst.Close()
+}
+
+func downloadFile(client *sftp.Client, remotePath, localPath string, size int64, logWriter io.Writer) (int64, error) {
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	err = os.MkdirAll(filepath.Dir(localPath), 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	n, err := src.WriteTo(&progressWriter{
+		Writer:   dst,
+		progress: newTransferProgress("Downloading", remotePath, size, logWriter),
+	})
+	if err != nil {
+		return n, fmt.Errorf("failed to read %s from VM: %w", remotePath, err)
+	}
+
+	return n, dst.Close()
+}
+
+// transferProgress reports the bytes transferred of a file every transferProgressInterval.
+type transferProgress struct {
+	action      string
+	path        string
+	size        int64
+	transferred int64
+	lastReport  time.Time
+	logWriter   io.Writer
+}
+
+func newTransferProgress(action, path string, size int64, logWriter io.Writer) *transferProgress {
+	return &transferProgress{
+		action:     action,
+		path:       path,
+		size:       size,
+		lastReport: time.Now(),
+		logWriter:  logWriter,
+	}
+}
+
+func (p *transferProgress) add(n int) {
+	p.transferred += int64(n)
+
+	if time.Since(p.lastReport) < transferProgressInterval {
+		return
+	}
+	p.lastReport = time.Now()
+
+	percent := int64(100)
+	if p.size > 0 {
+		percent = p.transferred * 100 / p.size
+	}
+	p.logWriter.Write([]byte(fmt.Sprintf("%s %s: %d of %d bytes (%d%%)\n", p.action, p.path, p.transferred, p.size, percent)))
+}
+
+type progressReader struct {
+	io.Reader
+	progress *transferProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.progress.add(n)
+	return n, err
+}
+
+// Size lets the SFTP client plan concurrent writes like for the unwrapped file.
+func (r *progressReader) Size() int64 {
+	return r.progress.size
+}
+
+type progressWriter struct {
+	io.Writer
+	progress *transferProgress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.progress.add(n)
+	return n, err
+}
+
+// getSftpRelPath returns the path of p relative to root, both being SFTP paths of the walk of root. path has no
+// Rel, and filepath.Rel would use the separators of the local OS.
+func getSftpRelPath(root, p string) (string, error) {
+	root, p = path.Clean(root), path.Clean(p)
+
+	switch {
+	case p == root:
+		return "", nil
+	case root == ".":
+		if !path.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../") {
+			return p, nil
+		}
+	case strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/"):
+		return strings.TrimPrefix(p, strings.TrimSuffix(root, "/")+"/"), nil
+	}
+
+	return "", fmt.Errorf("%s is not in %s", p, root)
+}
+
+// toSftpPath converts a Windows path to the form OpenSSH on Windows expects over SFTP, e.g. C:\Users\daytona
+// to /C:/Users/daytona.
+func toSftpPath(windowsPath string) string {
+	p := strings.ReplaceAll(windowsPath, "\\", "/")
+	if windowsDrivePathRegex.MatchString(p) {
+		p = "/" + p
+	}
+	if p == "" {
+		return "."
+	}
+
+	return path.Clean(p)
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import "testing"
+
+func TestGetSftpRelPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		root    string
+		p       string
+		want    string
+		wantErr bool
+	}{
+		{"root", "/C:/Users/daytona", "/C:/Users/daytona", "", false},
+		{"file", "/C:/Users/daytona", "/C:/Users/daytona/a.txt", "a.txt", false},
+		{"nested", "/C:/Users/daytona", "/C:/Users/daytona/dir/a.txt", "dir/a.txt", false},
+		{"sibling with the same prefix", "/C:/Users/daytona", "/C:/Users/daytona2/a.txt", "", true},
+		{"drive root", "/C:", "/C:/a.txt", "a.txt", false},
+		{"filesystem root", "/", "/C:/a.txt", "C:/a.txt", false},
+		{"relative root", "dir", "dir/.ssh/config", ".ssh/config", false},
+		{"home", ".", ".", "", false},
+		{"dot file in home", ".", ".ssh/config", ".ssh/config", false},
+		{"file in home", ".", "a.txt", "a.txt", false},
+		{"outside home", ".", "../a.txt", "", true},
+		{"absolute outside home", ".", "/C:/a.txt", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getSftpRelPath(tt.root, tt.p)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("getSftpRelPath(%q, %q) = %q, want an error", tt.root, tt.p, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getSftpRelPath(%q, %q) error = %v", tt.root, tt.p, err)
+			}
+			if got != tt.want {
+				t.Errorf("getSftpRelPath(%q, %q) = %q, want %q", tt.root, tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToSftpPath(t *testing.T) {
+	tests := []struct {
+		windowsPath string
+		want        string
+	}{
+		{"", "."},
+		{".ssh", ".ssh"},
+		{`C:\Users\daytona`, "/C:/Users/daytona"},
+		{`C:\Users\daytona\`, "/C:/Users/daytona"},
+		{"C:", "/C:"},
+		{`dir\file.txt`, "dir/file.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.windowsPath, func(t *testing.T) {
+			got := toSftpPath(tt.windowsPath)
+			if got != tt.want {
+				t.Errorf("toSftpPath(%q) = %q, want %q", tt.windowsPath, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,90 +5,224 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/daytonaio/daytona-provider-windows/pkg/jump_hosts"
+	"github.com/daytonaio/daytona-provider-windows/pkg/known_hosts"
+	"github.com/daytonaio/daytona-provider-windows/pkg/windows_quote"
 	"github.com/docker/docker/api/types"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
-func (d *DockerClient) WaitForWindowsBoot(containerID string, hostname *string) error {
-	c, err := d.apiClient.ContainerInspect(context.TODO(), containerID)
-	if err != nil {
-		return err
-	}
-	port := c.NetworkSettings.Ports["22/tcp"][0].HostPort
-
+func (d *DockerClient) GetSshClient(hostname *string, containerData types.ContainerJSON) (*ssh.Client, error) {
+	port := containerData.NetworkSettings.Ports["22/tcp"][0].HostPort
 	addr := fmt.Sprintf("localhost:%s", port)
+	dialer := &jump_hosts.Dialer{}
 	if hostname != nil {
 		addr = fmt.Sprintf("%s:%s", *hostname, port)
+
+		var err error
+		dialer, err = jump_hosts.NewDialer(d.targetOptions.JumpHosts, known_hosts.HostKeyCallback(d.knownHostsPath, d.targetOptions.KnownHostsFile))
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	credentials, err := d.getVmCredentials(containerData)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords := []string{credentials.Password}
+	if credentials.PendingPassword != "" {
+		// A password change was interrupted, the VM user has either of the passwords
+		passwords = []string{credentials.PendingPassword, credentials.Password}
+	}
+	attempts := 0
+
 	config := ssh.ClientConfig{
-		User:            "daytona",
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		User:            credentials.Username,
+		HostKeyCallback: d.getVmHostKeyCallback(getCredentialsId(containerData)),
 		Timeout:         5 * time.Second,
 		Auth: []ssh.AuthMethod{
-			ssh.Password("daytona"),
+			ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+				password := passwords[attempts]
+				attempts++
+				return password, nil
+			}), len(passwords)),
 		},
 	}
+	conn, err := dialer.Dial("tcp", addr, &config)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		time.Sleep(time.Second * 5)
+	if credentials.PendingPassword != "" {
+		d.resolvePendingVmPassword(getCredentialsId(containerData), credentials, passwords[attempts-1])
+	}
 
-		c, err := d.apiClient.ContainerInspect(context.TODO(), containerID)
-		if err != nil {
-			return err
-		}
+	return conn, nil
+}
+
+// getVmHostKeyCallback pins the host key of a VM under an alias derived from its id,
+// host ports of VMs are ephemeral and get reused.
+func (d *DockerClient) getVmHostKeyCallback(id string) ssh.HostKeyCallback {
+	callback := known_hosts.HostKeyCallback(d.knownHostsPath, d.targetOptions.KnownHostsFile)
+	if id == "" {
+		return callback
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return callback(getVmHostAlias(id), remote, key)
+	}
+}
+
+func getVmHostAlias(id string) string {
+	return net.JoinHostPort(fmt.Sprintf("%s.vm.daytona", id), "22")
+}
+
+// forgetVm removes the stored credentials and the pinned host key of a VM.
+func (d *DockerClient) forgetVm(id string) error {
+	err := d.removeVmCredentials(id)
+	if err != nil {
+		return fmt.Errorf("failed to remove VM credentials: %w", err)
+	}
+
+	err = known_hosts.Remove(d.knownHostsPath, getVmHostAlias(id))
+	if err != nil {
+		return fmt.Errorf("failed to remove VM host key: %w", err)
+	}
+
+	return nil
+}
+
+// ExecuteCommand runs a cmd.exe command line in the VM and fails if it exits with a non-zero exit code.
+func (d *DockerClient) ExecuteCommand(cmd string, logWriter io.Writer, conn *ssh.Client) error {
+	return d.execOrFail(VmExecOptions{
+		Command: cmd,
+		Stdout:  logWriter,
+		Stderr:  logWriter,
+	}, conn)
+}
+
+// executePowerShell runs a PowerShell script in the VM and fails if it exits with a non-zero exit code.
+func (d *DockerClient) executePowerShell(script string, logWriter io.Writer, conn *ssh.Client) error {
+	return d.execOrFail(VmExecOptions{
+		Command: script,
+		Shell:   VmShellPowerShell,
+		Stdout:  logWriter,
+		Stderr:  logWriter,
+	}, conn)
+}
 
-		if c.State.ExitCode != 0 || c.State.Error != "" {
-			return fmt.Errorf("container exited with error: %s", c.State.Error)
+func (d *DockerClient) execOrFail(opts VmExecOptions, conn *ssh.Client) error {
+	result, err := d.ExecInVm(context.Background(), conn, opts)
+	if err != nil {
+		return err
+	}
+
+	if result.ExitCode != 0 {
+		// The output of commands logging their output is already in the log
+		if opts.Stderr != nil {
+			return fmt.Errorf("command exited with code %d", result.ExitCode)
 		}
+		return fmt.Errorf("command exited with code %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	return nil
+}
+
+// forwardAgent makes the ssh-agent of the provider available to the session. The VM can request signatures over
+// conn until it is closed, the keys stay in the agent.
+func (d *DockerClient) forwardAgent(conn *ssh.Client, session *ssh.Session) error {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return errors.New("agent forwarding is enabled but SSH_AUTH_SOCK is not set")
+	}
 
-		conn, err := ssh.Dial("tcp", addr, &config)
+	// The agent channel handler can only be registered once per connection
+	if _, forwarded := d.agentForwardedConns.LoadOrStore(conn, true); !forwarded {
+		err := agent.ForwardToRemote(conn, sock)
 		if err != nil {
-			continue
+			d.agentForwardedConns.Delete(conn)
+			return fmt.Errorf("failed to forward ssh-agent: %w", err)
 		}
-		defer conn.Close()
 
-		break
+		go func() {
+			conn.Wait()
+			d.agentForwardedConns.Delete(conn)
+		}()
 	}
+
+	err := agent.RequestAgentForwarding(session)
+	if err != nil {
+		return fmt.Errorf("failed to request ssh-agent forwarding: %w", err)
+	}
+
 	return nil
 }
 
-func (d *DockerClient) GetSshClient(hostname *string, containerData types.ContainerJSON) (*ssh.Client, error) {
-	port := containerData.NetworkSettings.Ports["22/tcp"][0].HostPort
-	addr := fmt.Sprintf("localhost:%s", port)
-	if hostname != nil {
-		addr = fmt.Sprintf("%s:%s", *hostname, port)
+// rotateVmPassword replaces the password of the VM user, e.g. of a VM created from a golden image,
+// and stores the new credentials. The new password is stored as pending before the VM uses it and the previous
+// password is restored if it can not be set.
+func (d *DockerClient) rotateVmPassword(credentialsId string, conn *ssh.Client) error {
+	previous, err := d.loadVmCredentials(credentialsId)
+	if err != nil {
+		return fmt.Errorf("failed to load VM credentials: %w", err)
 	}
 
-	config := ssh.ClientConfig{
-		User:            "daytona",
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         5 * time.Second,
-		Auth: []ssh.AuthMethod{
-			ssh.Password("daytona"),
-		},
+	generated, err := generateVmCredentials()
+	if err != nil {
+		return err
 	}
-	conn, err := ssh.Dial("tcp", addr, &config)
+
+	pending := *previous
+	pending.PendingPassword = generated.Password
+	err = d.saveVmCredentials(credentialsId, &pending)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to save VM credentials: %w", err)
 	}
 
-	return conn, nil
+	err = d.setVmPassword(previous.Username, generated.Password, conn)
+	if err != nil {
+		// The credentials stay pending if the VM state is unknown, GetSshClient resolves them on the next connection
+		rollbackErr := d.setVmPassword(previous.Username, previous.Password, conn)
+		if rollbackErr == nil {
+			rollbackErr = d.saveVmCredentials(credentialsId, previous)
+		}
+		return errors.Join(fmt.Errorf("failed to change VM password: %w", err), rollbackErr)
+	}
+
+	return d.saveVmCredentials(credentialsId, &VmCredentials{
+		Username: previous.Username,
+		Password: generated.Password,
+	})
 }
 
-func (d *DockerClient) ExecuteCommand(cmd string, logWriter io.Writer, conn *ssh.Client) error {
-	session, err := conn.NewSession()
-	if err != nil {
-		return err
+// setVmPassword sets the password of the VM user and the password Windows logs the user on with.
+func (d *DockerClient) setVmPassword(username, password string, conn *ssh.Client) error {
+	cmds := [][]string{
+		{"net", "user", username, password},
+		{"reg", "add", "HKLM\\SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion\\Winlogon", "/v", "DefaultPassword", "/t", "REG_SZ", "/d", password, "/f"},
 	}
-	defer session.Close()
-	if logWriter != nil {
-		session.Stdout = logWriter
-		session.Stderr = logWriter
+	for _, args := range cmds {
+		cmd, err := windows_quote.CmdCommand(args[0], args[1:]...)
+		if err != nil {
+			return err
+		}
+
+		err = d.ExecuteCommand(cmd, nil, conn)
+		if err != nil {
+			return err
+		}
 	}
-	return session.Run(cmd)
+
+	return nil
 }
@@ -0,0 +1,155 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package docker_context
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultContextName is the implicit context of the Docker CLI that uses DOCKER_HOST or the local socket
+const DefaultContextName = "default"
+
+// DockerContext is a Docker CLI context, see https://docs.docker.com/engine/manage-resources/contexts/
+type DockerContext struct {
+	Name        string
+	Description string
+	// Host is the Docker endpoint of the context, e.g. unix:///var/run/docker.sock, tcp://host:2376 or ssh://user@host
+	Host        string
+	TlsCaPath   string
+	TlsCertPath string
+	TlsKeyPath  string
+}
+
+type contextMeta struct {
+	Name     string `json:"Name"`
+	Metadata struct {
+		Description string `json:"Description"`
+	} `json:"Metadata"`
+	Endpoints map[string]struct {
+		Host string `json:"Host"`
+	} `json:"Endpoints"`
+}
+
+// List returns the contexts of the Docker CLI of the current user sorted by name, without the default context
+func List() ([]DockerContext, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	metaFiles, err := filepath.Glob(filepath.Join(configDir, "contexts", "meta", "*", "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	contexts := []DockerContext{}
+	for _, metaFile := range metaFiles {
+		dockerContext, err := readContext(configDir, metaFile)
+		if err != nil {
+			// A broken context must not hide the others
+			log.Warnf("skipping Docker context %s: %v", metaFile, err)
+			continue
+		}
+		if dockerContext != nil {
+			contexts = append(contexts, *dockerContext)
+		}
+	}
+
+	sort.Slice(contexts, func(i, j int) bool {
+		return contexts[i].Name < contexts[j].Name
+	})
+
+	return contexts, nil
+}
+
+// Get returns the Docker CLI context with the given name
+func Get(name string) (*DockerContext, error) {
+	if name == DefaultContextName {
+		return nil, errors.New("the default Docker context has no stored endpoint")
+	}
+
+	configDir, err := getConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	metaFile := filepath.Join(configDir, "contexts", "meta", getContextDirName(name), "meta.json")
+	dockerContext, err := readContext(configDir, metaFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("Docker context %s not found", name)
+		}
+		return nil, err
+	}
+	if dockerContext == nil {
+		return nil, fmt.Errorf("Docker context %s has no Docker endpoint", name)
+	}
+
+	return dockerContext, nil
+}
+
+func readContext(configDir string, metaFile string) (*DockerContext, error) {
+	content, err := os.ReadFile(metaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta contextMeta
+	err = json.Unmarshal(content, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Docker context %s: %w", metaFile, err)
+	}
+
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return nil, nil
+	}
+
+	dockerContext := &DockerContext{
+		Name:        meta.Name,
+		Description: meta.Metadata.Description,
+		Host:        endpoint.Host,
+	}
+
+	tlsDir := filepath.Join(configDir, "contexts", "tls", getContextDirName(meta.Name), "docker")
+	for file, tlsPath := range map[string]*string{
+		"ca.pem":   &dockerContext.TlsCaPath,
+		"cert.pem": &dockerContext.TlsCertPath,
+		"key.pem":  &dockerContext.TlsKeyPath,
+	} {
+		if _, err := os.Stat(filepath.Join(tlsDir, file)); err == nil {
+			*tlsPath = filepath.Join(tlsDir, file)
+		}
+	}
+
+	return dockerContext, nil
+}
+
+// getContextDirName returns the directory name the Docker CLI stores a context under
+func getContextDirName(name string) string {
+	hash := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(hash[:])
+}
+
+func getConfigDir() (string, error) {
+	if configDir := os.Getenv("DOCKER_CONFIG"); configDir != "" {
+		return configDir, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".docker"), nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package known_hosts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// mutex serializes writes to the known_hosts files of the provider.
+var mutex sync.Mutex
+
+// HostKeyMismatchError is returned when a host presents a key different from the pinned one.
+type HostKeyMismatchError struct {
+	Host           string
+	Fingerprint    string
+	KnownHostsPath string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key verification failed for %s: the host presented key %s which does not match the key pinned in %s. "+
+		"If the host was reinstalled, remove its entry from that file", e.Host, e.Fingerprint, e.KnownHostsPath)
+}
+
+// HostKeyCallback verifies host keys against the user supplied known_hosts file, if set, and the known_hosts
+// file of the provider. Hosts unknown to both are trusted on first use and pinned in the provider's file.
+func HostKeyCallback(knownHostsPath string, userKnownHostsPath *string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		userKnownHostsFile := ""
+		if userKnownHostsPath != nil && *userKnownHostsPath != "" {
+			var err error
+			userKnownHostsFile, err = resolveUserKnownHostsFile(*userKnownHostsPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if userKnownHostsFile != "" {
+			known, err := check(userKnownHostsFile, hostname, remote, key)
+			if err != nil {
+				return err
+			}
+			if known {
+				return nil
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		err := ensureFile(knownHostsPath)
+		if err != nil {
+			return err
+		}
+
+		known, err := check(knownHostsPath, hostname, remote, key)
+		if err != nil {
+			return err
+		}
+		if known {
+			return nil
+		}
+
+		return appendLine(knownHostsPath, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	}
+}
+
+// Remove deletes the pinned keys of host, e.g. once the VM it belongs to is destroyed.
+func Remove(knownHostsPath string, host string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	content, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	normalized := knownhosts.Normalize(host)
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) > 0 && containsHost(fields[0], normalized) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	output := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		output += "\n"
+	}
+
+	return os.WriteFile(knownHostsPath, []byte(output), 0600)
+}
+
+// check returns whether the host key is pinned in the known_hosts file and fails if a different key is pinned.
+func check(knownHostsPath string, hostname string, remote net.Addr, key ssh.PublicKey) (bool, error) {
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read known hosts file %s: %w", knownHostsPath, err)
+	}
+
+	err = callback(hostname, remote, key)
+	if err == nil {
+		return true, nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		if len(keyErr.Want) == 0 {
+			return false, nil
+		}
+		return false, &HostKeyMismatchError{
+			Host:           hostname,
+			Fingerprint:    ssh.FingerprintSHA256(key),
+			KnownHostsPath: knownHostsPath,
+		}
+	}
+
+	return false, err
+}
+
+func containsHost(hosts string, host string) bool {
+	for _, h := range strings.Split(hosts, ",") {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+func ensureFile(knownHostsPath string) error {
+	err := os.MkdirAll(filepath.Dir(knownHostsPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(knownHostsPath, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func appendLine(knownHostsPath string, line string) error {
+	f, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(line + "\n")
+	return err
+}
+
+// resolveUserKnownHostsFile returns the known_hosts file to check for a user supplied path. A directory, such as
+// the default ~/.ssh, refers to the known_hosts file in it, which is skipped if it doesn't exist.
+func resolveUserKnownHostsFile(userKnownHostsPath string) (string, error) {
+	userKnownHostsFile, err := expandHome(userKnownHostsPath)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(userKnownHostsFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read known hosts file %s: %w", userKnownHostsFile, err)
+	}
+	if !info.IsDir() {
+		return userKnownHostsFile, nil
+	}
+
+	userKnownHostsFile = filepath.Join(userKnownHostsFile, "known_hosts")
+	_, err = os.Stat(userKnownHostsFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return userKnownHostsFile, nil
+}
+
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, strings.TrimPrefix(p, "~")), nil
+}
@@ -35,6 +35,7 @@ func (p WindowsProvider) CreateTarget(targetReq *provider.TargetRequest) (*provi
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
+	defer dockerClient.Close()
 
 	targetDir, err := p.getTargetDir(targetReq)
 	if err != nil {
@@ -77,6 +78,7 @@ func (p WindowsProvider) CreateWorkspace(workspaceReq *provider.WorkspaceRequest
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
+	defer dockerClient.Close()
 
 	workspaceDir, err := p.getWorkspaceDir(workspaceReq)
 	if err != nil {
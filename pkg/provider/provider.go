@@ -2,16 +2,23 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"runtime"
+	"strings"
+	"time"
 
 	internal "github.com/daytonaio/daytona-provider-windows/internal"
 	log_writers "github.com/daytonaio/daytona-provider-windows/internal/log"
 	"github.com/daytonaio/daytona-provider-windows/pkg/client"
+	"github.com/daytonaio/daytona-provider-windows/pkg/docker_context"
+	"github.com/daytonaio/daytona-provider-windows/pkg/jump_hosts"
+	"github.com/daytonaio/daytona-provider-windows/pkg/known_hosts"
+	"github.com/daytonaio/daytona-provider-windows/pkg/ssh_tunnel/util"
 	"github.com/daytonaio/daytona-provider-windows/pkg/types"
 
 	"github.com/daytonaio/daytona-provider-windows/pkg/docker"
@@ -21,6 +28,8 @@ import (
 	provider_util "github.com/daytonaio/daytona/pkg/provider/util"
 	"github.com/daytonaio/daytona/pkg/ssh"
 	docker_sdk "github.com/docker/docker/client"
+	log "github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 type WindowsProvider struct {
@@ -35,6 +44,7 @@ type WindowsProvider struct {
 	ApiPort            *uint32
 	ServerPort         *uint32
 	RemoteSockDir      string
+	tunnelManager      *client.TunnelManager
 }
 
 func (p *WindowsProvider) Initialize(req provider.InitializeProviderRequest) (*provider_util.Empty, error) {
@@ -69,9 +79,18 @@ func (p *WindowsProvider) Initialize(req provider.InitializeProviderRequest) (*p
 	p.ApiPort = &req.ApiPort
 	p.ServerPort = &req.ServerPort
 
+	p.tunnelManager = client.NewTunnelManager(p.RemoteSockDir, p.getKnownHostsPath())
+
 	return new(provider_util.Empty), nil
 }
 
+// Close stops the SSH tunnels to remote Docker hosts. It is called when the plugin process exits.
+func (p *WindowsProvider) Close() {
+	if p.tunnelManager != nil {
+		p.tunnelManager.Close()
+	}
+}
+
 func (p WindowsProvider) GetInfo() (models.ProviderInfo, error) {
 	label := "Windows"
 
@@ -85,24 +104,118 @@ func (p WindowsProvider) GetInfo() (models.ProviderInfo, error) {
 }
 
 func (p WindowsProvider) GetPresetTargetConfigs() (*[]provider.TargetConfig, error) {
-	return &[]provider.TargetConfig{
+	presets := []provider.TargetConfig{
 		{
 			Name:    "local",
 			Options: "{\n\t\"Sock Path\": \"/var/run/docker.sock\"\n}",
 		},
-	}, nil
+	}
+
+	// The local preset follows DOCKER_HOST like the Docker CLI, which can point to a remote daemon
+	dockerHost := os.Getenv(docker_sdk.EnvOverrideHost)
+	if dockerHost != "" && !strings.HasPrefix(dockerHost, "unix://") && !strings.HasPrefix(dockerHost, "npipe://") {
+		options, err := json.MarshalIndent(types.TargetConfigOptions{DockerHost: &dockerHost}, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		presets[0].Options = string(options)
+	}
+
+	dockerContexts, err := docker_context.List()
+	if err != nil {
+		log.Warnf("failed to read Docker contexts: %v", err)
+		return &presets, nil
+	}
+
+	for _, dockerContext := range dockerContexts {
+		if dockerContext.Name == presets[0].Name {
+			continue
+		}
+
+		options, err := json.MarshalIndent(types.TargetConfigOptions{DockerContext: &dockerContext.Name}, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+
+		presets = append(presets, provider.TargetConfig{
+			Name:    dockerContext.Name,
+			Options: string(options),
+		})
+	}
+
+	return &presets, nil
 }
 
 func (p WindowsProvider) StartTarget(targetReq *provider.TargetRequest) (*provider_util.Empty, error) {
-	return new(provider_util.Empty), nil
+	logWriter := io.MultiWriter(&log_writers.InfoLogWriter{})
+	if p.TargetLogsDir != nil {
+		loggerFactory := logs.NewLoggerFactory(logs.LoggerFactoryConfig{
+			LogsDir:     *p.TargetLogsDir,
+			ApiUrl:      p.ApiUrl,
+			ApiKey:      p.ApiKey,
+			ApiBasePath: &logs.ApiBasePathTarget,
+		})
+		targetLogWriter, err := loggerFactory.CreateLogger(targetReq.Target.Id, targetReq.Target.Name, logs.LogSourceProvider)
+		if err != nil {
+			return new(provider_util.Empty), err
+		}
+		logWriter = io.MultiWriter(&log_writers.InfoLogWriter{}, targetLogWriter)
+		defer targetLogWriter.Close()
+	}
+
+	dockerClient, err := p.getClient(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+	defer dockerClient.Close()
+
+	targetDir, err := p.getTargetDir(targetReq)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+
+	sshClient, err := p.getSshClient(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+	if sshClient != nil {
+		defer sshClient.Close()
+	}
+
+	return new(provider_util.Empty), dockerClient.StartTarget(targetReq.Target, targetDir, logWriter, sshClient)
 }
 
 func (p WindowsProvider) StopTarget(targetReq *provider.TargetRequest) (*provider_util.Empty, error) {
-	return new(provider_util.Empty), nil
+	dockerClient, err := p.getClient(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+	defer dockerClient.Close()
+
+	return new(provider_util.Empty), dockerClient.StopTarget(targetReq.Target, &log_writers.InfoLogWriter{})
 }
 
 func (p WindowsProvider) DestroyTarget(targetReq *provider.TargetRequest) (*provider_util.Empty, error) {
-	return new(provider_util.Empty), nil
+	dockerClient, err := p.getClient(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+	defer dockerClient.Close()
+
+	targetDir, err := p.getTargetDir(targetReq)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+
+	sshClient, err := p.getSshClient(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+	if sshClient != nil {
+		defer sshClient.Close()
+	}
+
+	return new(provider_util.Empty), dockerClient.DestroyTarget(targetReq.Target, targetDir, sshClient)
 }
 
 func (p WindowsProvider) DestroyWorkspace(workspaceReq *provider.WorkspaceRequest) (*provider_util.Empty, error) {
@@ -110,6 +223,7 @@ func (p WindowsProvider) DestroyWorkspace(workspaceReq *provider.WorkspaceReques
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
+	defer dockerClient.Close()
 
 	workspaceDir, err := p.getWorkspaceDir(workspaceReq)
 	if err != nil {
@@ -137,15 +251,34 @@ func (p WindowsProvider) GetTargetProviderMetadata(targetReq *provider.TargetReq
 	if err != nil {
 		return "", err
 	}
+	defer dockerClient.Close()
+
+	targetDir, err := p.getTargetDir(targetReq)
+	if err != nil {
+		return "", err
+	}
 
-	return dockerClient.GetTargetProviderMetadata(targetReq.Target)
+	sshClient, err := p.getSshClient(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return "", err
+	}
+	if sshClient != nil {
+		defer sshClient.Close()
+	}
+
+	return dockerClient.GetTargetProviderMetadata(targetReq.Target, targetDir, sshClient)
 }
 
 func (p WindowsProvider) StartWorkspace(workspaceReq *provider.WorkspaceRequest) (*provider_util.Empty, error) {
+	if p.DaytonaDownloadUrl == nil {
+		return new(provider_util.Empty), errors.New("ServerDownloadUrl not set. Did you forget to call Initialize?")
+	}
+
 	dockerClient, err := p.getClient(workspaceReq.Workspace.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
+	defer dockerClient.Close()
 
 	logWriter := io.MultiWriter(&log_writers.InfoLogWriter{})
 	if p.WorkspaceLogsDir != nil {
@@ -176,7 +309,7 @@ func (p WindowsProvider) StartWorkspace(workspaceReq *provider.WorkspaceRequest)
 		LogWriter:           logWriter,
 		Gpc:                 workspaceReq.GitProviderConfig,
 		SshClient:           nil,
-	}, "")
+	}, *p.DaytonaDownloadUrl)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
@@ -189,6 +322,7 @@ func (p WindowsProvider) StopWorkspace(workspaceReq *provider.WorkspaceRequest)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
+	defer dockerClient.Close()
 
 	logWriter := io.MultiWriter(&log_writers.InfoLogWriter{})
 	if p.WorkspaceLogsDir != nil {
@@ -219,6 +353,7 @@ func (p WindowsProvider) GetWorkspaceProviderMetadata(workspaceReq *provider.Wor
 	if err != nil {
 		return "", err
 	}
+	defer dockerClient.Close()
 
 	return dockerClient.GetWorkspaceProviderMetadata(workspaceReq.Workspace)
 }
@@ -229,14 +364,34 @@ func (p WindowsProvider) getClient(targetOptionsJson string) (docker.IDockerClie
 		return nil, err
 	}
 
-	client, err := client.GetClient(*targetOptions, p.RemoteSockDir)
+	client, release, err := client.GetClient(*targetOptions, p.tunnelManager)
 	if err != nil {
 		return nil, err
 	}
 
+	credentialsDir := ""
+	if p.BasePath != nil {
+		credentialsDir = path.Join(*p.BasePath, "credentials")
+	}
+
+	daytonaDownloadUrl := ""
+	if p.DaytonaDownloadUrl != nil {
+		daytonaDownloadUrl = *p.DaytonaDownloadUrl
+	}
+
+	daytonaVersion := ""
+	if p.DaytonaVersion != nil {
+		daytonaVersion = *p.DaytonaVersion
+	}
+
 	return docker.NewDockerClient(docker.DockerClientConfig{
-		ApiClient:     client,
-		TargetOptions: *targetOptions,
+		ApiClient:          client,
+		TargetOptions:      *targetOptions,
+		CredentialsDir:     credentialsDir,
+		KnownHostsPath:     p.getKnownHostsPath(),
+		Release:            release,
+		DaytonaDownloadUrl: daytonaDownloadUrl,
+		DaytonaVersion:     daytonaVersion,
 	}), nil
 }
 
@@ -259,6 +414,7 @@ func (p WindowsProvider) CheckRequirements() (*[]provider.RequirementStatus, err
 			Reason: "Docker is installed",
 		})
 	}
+	defer cli.Close()
 
 	// Check if Docker is running by fetching Docker info
 	_, err = cli.Info(ctx)
@@ -283,8 +439,26 @@ func (p *WindowsProvider) getWorkspaceDir(workspaceReq *provider.WorkspaceReques
 	return fmt.Sprintf("C:\\Users\\daytona\\Desktop\\%s\\%s", workspaceReq.Workspace.Target.Name, workspaceReq.Workspace.Name), nil
 }
 
+// Target directory is on the Docker host and holds the target data and shared caches.
 func (p *WindowsProvider) getTargetDir(targetReq *provider.TargetRequest) (string, error) {
-	return fmt.Sprintf("C:\\Users\\daytona\\Desktop\\%s", targetReq.Target.Name), nil
+	targetOptions, isLocal, err := types.ParseTargetConfigOptions(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return "", err
+	}
+
+	if isLocal {
+		if p.BasePath == nil {
+			return "", errors.New("BasePath not set. Did you forget to call Initialize?")
+		}
+		return path.Join(*p.BasePath, "targets", targetReq.Target.Id), nil
+	}
+
+	targetDataDir := "/tmp/daytona-data"
+	if targetOptions.TargetDataDir != nil && *targetOptions.TargetDataDir != "" {
+		targetDataDir = *targetOptions.TargetDataDir
+	}
+
+	return path.Join(targetDataDir, targetReq.Target.Id), nil
 }
 
 func (p *WindowsProvider) getSshClient(targetOptionsJson string) (*ssh.Client, error) {
@@ -293,15 +467,51 @@ func (p *WindowsProvider) getSshClient(targetOptionsJson string) (*ssh.Client, e
 		return nil, err
 	}
 
-	if isLocal {
+	// Targets reaching the Docker Host directly without an SSH hostname access the host through Docker only
+	if isLocal || targetOptions.RemoteHostname == nil {
 		return nil, nil
 	}
 
-	return ssh.NewClient(&ssh.SessionConfig{
-		Hostname:       *targetOptions.RemoteHostname,
-		Port:           *targetOptions.RemotePort,
-		Username:       *targetOptions.RemoteUser,
-		Password:       targetOptions.RemotePassword,
-		PrivateKeyPath: targetOptions.RemotePrivateKey,
+	auth := []gossh.AuthMethod{}
+	if targetOptions.RemotePassword != nil {
+		auth = append(auth, gossh.Password(*targetOptions.RemotePassword))
+	}
+
+	if targetOptions.RemotePrivateKey != nil {
+		authMethod, err := util.GetSshAuthMethod(*targetOptions.RemotePrivateKey, targetOptions.RemotePassphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		auth = append(auth, authMethod)
+	}
+
+	hostKeyCallback := known_hosts.HostKeyCallback(p.getKnownHostsPath(), targetOptions.KnownHostsFile)
+
+	dialer, err := jump_hosts.NewDialer(targetOptions.JumpHosts, hostKeyCallback)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dialer.Dial("tcp", fmt.Sprintf("%s:%d", *targetOptions.RemoteHostname, *targetOptions.RemotePort), &gossh.ClientConfig{
+		User:            *targetOptions.RemoteUser,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
 	})
+	if err != nil {
+		return nil, fmt.Errorf("dialing SSH server: %w", err)
+	}
+
+	return &ssh.Client{
+		Client: client,
+	}, nil
+}
+
+func (p *WindowsProvider) getKnownHostsPath() string {
+	if p.BasePath == nil {
+		return ""
+	}
+
+	return path.Join(*p.BasePath, "known_hosts")
 }
@@ -35,6 +35,8 @@ const (
 	// AuthTypeAuto tries to get the authentication method automatically. See SSHTun.Start for details on
 	// this.
 	AuthTypeAuto
+	// AuthTypeAuthMethod uses an auth method set with SetAuthMethod.
+	AuthTypeAuthMethod
 )
 
 func (tun *SshTunnel) getSSHAuthMethod() (ssh.AuthMethod, error) {
@@ -51,6 +53,8 @@ func (tun *SshTunnel) getSSHAuthMethod() (ssh.AuthMethod, error) {
 		return ssh.Password(tun.authPassword), nil
 	case AuthTypeSSHServer:
 		return tun.getSSHAuthMethodForSSHServer()
+	case AuthTypeAuthMethod:
+		return tun.authMethod, nil
 	case AuthTypeAuto:
 		method, errFile := tun.getSSHAuthMethodForKeyFile(false)
 		if errFile == nil {
@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -37,7 +38,7 @@ func (s *TunneledConnectionState) String() string {
 	return out
 }
 
-func (tun *SshTunnel) forward(localConn net.Conn) {
+func (tun *SshTunnel) forward(localConn net.Conn, sshClient *ssh.Client) {
 	from := localConn.RemoteAddr().String()
 
 	tun.tunneledState(&TunneledConnectionState{
@@ -45,7 +46,7 @@ func (tun *SshTunnel) forward(localConn net.Conn) {
 		Info: fmt.Sprintf("accepted %s connection", tun.local.Type()),
 	})
 
-	remoteConn, err := tun.SshClient.Dial(tun.remote.Type(), tun.remote.String())
+	remoteConn, err := sshClient.Dial(tun.remote.Type(), tun.remote.String())
 	if err != nil {
 		tun.tunneledState(&TunneledConnectionState{
 			From:  from,
@@ -87,7 +88,19 @@ func (tun *SshTunnel) forward(localConn net.Conn) {
 		return localConn.Close()
 	})
 
+	// Close both ends when the tunnel is stopped so long-lived connections don't keep it from shutting down
+	copied := make(chan struct{})
+	go func() {
+		select {
+		case <-tun.ctx.Done():
+			localConn.Close()
+			remoteConn.Close()
+		case <-copied:
+		}
+	}()
+
 	err = errGroup.Wait()
+	close(copied)
 
 	<-connCtx.Done()
 
@@ -26,17 +26,26 @@ type SshTunnel struct {
 	authKeyFile       string
 	authKeyReader     io.Reader
 	authPassword      string
+	authMethod        ssh.AuthMethod
 	Server            *Endpoint
 	local             *Endpoint
 	remote            *Endpoint
 	timeout           time.Duration
 	connState         func(*SshTunnel, ConnectionState)
 	tunneledConnState func(*SshTunnel, *TunneledConnectionState)
+	hostKeyCallback   ssh.HostKeyCallback
+	dialFunc          func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error)
 	active            int
 	SshConfig         *ssh.ClientConfig
 	SshClient         *ssh.Client
 }
 
+const (
+	dialAttempts      = 3
+	dialRetryInterval = 2 * time.Second
+	keepAliveInterval = 30 * time.Second
+)
+
 // ConnectionState represents the state of the SSH tunnel. It's returned to an optional function provided to SetConnState.
 type ConnectionState int
 
@@ -53,6 +62,19 @@ const (
 	StateStarted
 )
 
+func (s ConnectionState) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateStarting:
+		return "starting"
+	case StateStarted:
+		return "started"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(s))
+	}
+}
+
 // New creates a new SSH tunnel to the specified server redirecting a port on local localhost to a port on remote localhost.
 // By default the SSH connection is made to port 22 as root and using automatic detection of the authentication
 // method (see Start for details on this).
@@ -138,6 +160,12 @@ func (tun *SshTunnel) SetPassword(password string) {
 	tun.authPassword = password
 }
 
+// SetAuthMethod changes the authentication to the specified auth method, e.g. a key loaded beforehand.
+func (tun *SshTunnel) SetAuthMethod(authMethod ssh.AuthMethod) {
+	tun.authType = AuthTypeAuthMethod
+	tun.authMethod = authMethod
+}
+
 // SetLocalHost sets the local host to redirect (defaults to localhost).
 func (tun *SshTunnel) SetLocalHost(host string) {
 	tun.local.host = host
@@ -175,6 +203,18 @@ func (tun *SshTunnel) SetTunneledConnState(tunneledConnStateFun func(*SshTunnel,
 	tun.tunneledConnState = tunneledConnStateFun
 }
 
+// SetHostKeyCallback specifies the callback used to verify the server's host key.
+// By default any host key is accepted.
+func (tun *SshTunnel) SetHostKeyCallback(hostKeyCallback ssh.HostKeyCallback) {
+	tun.hostKeyCallback = hostKeyCallback
+}
+
+// SetDialFunc specifies the function used to connect to the SSH server, e.g. through jump hosts.
+// It defaults to ssh.Dial.
+func (tun *SshTunnel) SetDialFunc(dialFunc func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error)) {
+	tun.dialFunc = dialFunc
+}
+
 // Start starts the SSH tunnel. It can be stopped by calling `Stop` or cancelling its context.
 // This call will block until the tunnel is stopped either calling those methods or by an error.
 // Note on SSH authentication: in case the tunnel's authType is set to AuthTypeAuto the following will happen:
@@ -238,6 +278,10 @@ func (tun *SshTunnel) InitSSHConfig() (*ssh.ClientConfig, error) {
 		Timeout: tun.timeout,
 	}
 
+	if tun.hostKeyCallback != nil {
+		config.HostKeyCallback = tun.hostKeyCallback
+	}
+
 	authMethod, err := tun.getSSHAuthMethod()
 	if err != nil {
 		return nil, err
@@ -290,32 +334,40 @@ func (tun *SshTunnel) listen(localListener net.Listener) error {
 }
 
 func (tun *SshTunnel) handle(localConn net.Conn) error {
-	err := tun.addConn()
+	sshClient, err := tun.addConn()
 	if err != nil {
-		return err
+		tun.tunneledState(&TunneledConnectionState{
+			From:  localConn.RemoteAddr().String(),
+			Error: err,
+		})
+
+		localConn.Close()
+		return nil
 	}
 
-	tun.forward(localConn)
+	tun.forward(localConn, sshClient)
 	tun.removeConn()
 
 	return nil
 }
 
-func (tun *SshTunnel) addConn() error {
+func (tun *SshTunnel) addConn() (*ssh.Client, error) {
 	tun.mutex.Lock()
 	defer tun.mutex.Unlock()
 
-	if tun.active == 0 {
-		sshClient, err := ssh.Dial(tun.Server.Type(), tun.Server.String(), tun.SshConfig)
+	if tun.SshClient == nil {
+		sshClient, err := tun.dial()
 		if err != nil {
-			return fmt.Errorf("ssh dial %s to %s failed: %w", tun.Server.Type(), tun.Server.String(), err)
+			return nil, err
 		}
 		tun.SshClient = sshClient
+
+		go tun.keepAlive(sshClient)
 	}
 
 	tun.active += 1
 
-	return nil
+	return tun.SshClient, nil
 }
 
 func (tun *SshTunnel) removeConn() {
@@ -324,8 +376,76 @@ func (tun *SshTunnel) removeConn() {
 
 	tun.active -= 1
 
-	if tun.active == 0 {
+	if tun.active == 0 && tun.SshClient != nil {
 		tun.SshClient.Close()
 		tun.SshClient = nil
 	}
 }
+
+// dial connects to the SSH server, retrying a few times so that a server restart or a short network
+// outage does not fail the tunneled connection.
+func (tun *SshTunnel) dial() (*ssh.Client, error) {
+	dialFunc := ssh.Dial
+	if tun.dialFunc != nil {
+		dialFunc = tun.dialFunc
+	}
+
+	var err error
+	for attempt := 0; attempt < dialAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-tun.ctx.Done():
+				return nil, tun.ctx.Err()
+			case <-time.After(dialRetryInterval):
+			}
+		}
+
+		var sshClient *ssh.Client
+		sshClient, err = dialFunc(tun.Server.Type(), tun.Server.String(), tun.SshConfig)
+		if err == nil {
+			return sshClient, nil
+		}
+	}
+
+	return nil, fmt.Errorf("ssh dial %s to %s failed: %w", tun.Server.Type(), tun.Server.String(), err)
+}
+
+// keepAlive probes the SSH connection until it is closed. A connection that stops responding is closed
+// and dropped so the next tunneled connection re-dials the server instead of reusing a dead connection.
+func (tun *SshTunnel) keepAlive(sshClient *ssh.Client) {
+	closed := make(chan struct{})
+	go func() {
+		sshClient.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			tun.mutex.Lock()
+			if tun.SshClient == sshClient {
+				tun.SshClient = nil
+			}
+			tun.mutex.Unlock()
+			return
+		case <-ticker.C:
+			replied := make(chan error, 1)
+			go func() {
+				_, _, err := sshClient.SendRequest("keepalive@openssh.com", true, nil)
+				replied <- err
+			}()
+
+			select {
+			case err := <-replied:
+				if err != nil {
+					sshClient.Close()
+				}
+			case <-time.After(tun.timeout):
+				sshClient.Close()
+			}
+		}
+	}
+}
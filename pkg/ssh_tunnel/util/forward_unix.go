@@ -1,19 +1,18 @@
 package util
 
 import (
-	"context"
 	"errors"
 
+	"github.com/daytonaio/daytona-provider-windows/pkg/known_hosts"
 	"github.com/daytonaio/daytona-provider-windows/pkg/ssh_tunnel"
 	"github.com/daytonaio/daytona-provider-windows/pkg/types"
-	log "github.com/sirupsen/logrus"
 )
 
-func ForwardRemoteUnixSock(ctx context.Context, targetOptions types.TargetConfigOptions, localSock string, remoteSock string) (chan bool, chan error) {
+// NewRemoteUnixSockTunnel configures, but does not start, a tunnel forwarding localSock to remoteSock on the remote host.
+// Jump hosts are not set up, jump_hosts depends on this package to load keys.
+func NewRemoteUnixSockTunnel(targetOptions types.TargetConfigOptions, knownHostsPath string, localSock string, remoteSock string) (*ssh_tunnel.SshTunnel, error) {
 	if targetOptions.RemoteHostname == nil {
-		errChan := make(chan error)
-		errChan <- errors.New("Remote Hostname is required")
-		return make(chan bool), errChan
+		return nil, errors.New("Remote Hostname is required")
 	}
 
 	sshTun := ssh_tunnel.NewUnix(localSock, *targetOptions.RemoteHostname, remoteSock)
@@ -21,6 +20,8 @@ func ForwardRemoteUnixSock(ctx context.Context, targetOptions types.TargetConfig
 	if targetOptions.RemotePort != nil {
 		sshTun.SetPort(*targetOptions.RemotePort)
 	}
+	sshTun.SetHostKeyCallback(known_hosts.HostKeyCallback(knownHostsPath, targetOptions.KnownHostsFile))
+
 	if targetOptions.RemoteUser != nil {
 		sshTun.SetUser(*targetOptions.RemoteUser)
 	}
@@ -28,40 +29,12 @@ func ForwardRemoteUnixSock(ctx context.Context, targetOptions types.TargetConfig
 	if targetOptions.RemotePassword != nil && *targetOptions.RemotePassword != "" {
 		sshTun.SetPassword(*targetOptions.RemotePassword)
 	} else if targetOptions.RemotePrivateKey != nil && *targetOptions.RemotePrivateKey != "" {
-		privateKeyPath, password, err := GetSshPrivateKeyPath(*targetOptions.RemotePrivateKey)
+		authMethod, err := GetSshAuthMethod(*targetOptions.RemotePrivateKey, targetOptions.RemotePassphrase)
 		if err != nil {
-			log.Fatal(err)
-		}
-		if password != nil {
-			sshTun.SetEncryptedKeyFile(privateKeyPath, *password)
-		} else {
-			sshTun.SetKeyFile(privateKeyPath)
+			return nil, err
 		}
+		sshTun.SetAuthMethod(authMethod)
 	}
 
-	errChan := make(chan error)
-
-	sshTun.SetTunneledConnState(func(tun *ssh_tunnel.SshTunnel, state *ssh_tunnel.TunneledConnectionState) {
-		log.Debugf("%+v", state)
-	})
-
-	startedChann := make(chan bool, 1)
-
-	sshTun.SetConnState(func(tun *ssh_tunnel.SshTunnel, state ssh_tunnel.ConnectionState) {
-		switch state {
-		case ssh_tunnel.StateStarting:
-			log.Debugf("SSH Tunnel is Starting")
-		case ssh_tunnel.StateStarted:
-			log.Debugf("SSH Tunnel is Started")
-			startedChann <- true
-		case ssh_tunnel.StateStopped:
-			log.Debugf("SSH Tunnel is Stopped")
-		}
-	})
-
-	go func() {
-		errChan <- sshTun.Start(ctx)
-	}()
-
-	return startedChann, errChan
+	return sshTun, nil
 }
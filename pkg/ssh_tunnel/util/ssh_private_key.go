@@ -1,37 +1,142 @@
 package util
 
 import (
+	"bytes"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/term"
+	"golang.org/x/crypto/ssh/agent"
 )
 
-// GetSshPrivateKeyPath returns the path to the private key and the password if it's encrypted
-func GetSshPrivateKeyPath(privateKeyPath string) (string, *string, error) {
+var (
+	// ErrPassphraseRequired is returned for an encrypted key without a passphrase that isn't loaded in the ssh-agent
+	ErrPassphraseRequired = errors.New("the key is encrypted: set the Remote Private Key Passphrase or add the key to the ssh-agent")
+	// ErrIncorrectPassphrase is returned when the passphrase doesn't decrypt the key
+	ErrIncorrectPassphrase = errors.New("the Remote Private Key Passphrase is incorrect")
+)
+
+// PrivateKeyError is returned when the private key of the remote host can't be used
+type PrivateKeyError struct {
+	Path string
+	Err  error
+}
+
+func (e *PrivateKeyError) Error() string {
+	return fmt.Sprintf("failed to load SSH private key %s: %v", e.Path, e.Err)
+}
+
+func (e *PrivateKeyError) Unwrap() error {
+	return e.Err
+}
+
+// GetSshAuthMethod returns the auth method for the private key. Encrypted keys are decrypted with the passphrase
+// or, if it isn't set, used through the ssh-agent holding it.
+func GetSshAuthMethod(privateKeyPath string, passphrase *string) (ssh.AuthMethod, error) {
 	keyContent, err := os.ReadFile(privateKeyPath)
 	if err != nil {
-		return "", nil, err
+		return nil, &PrivateKeyError{Path: privateKeyPath, Err: err}
 	}
 
-	_, err = ssh.ParsePrivateKey(keyContent)
+	signer, err := ssh.ParsePrivateKey(keyContent)
 	if err == nil {
-		return privateKeyPath, nil, err
+		return ssh.PublicKeys(signer), nil
 	}
 
-	if err.Error() == (&ssh.PassphraseMissingError{}).Error() {
-		fmt.Print("Enter password for key: ")
-		password, err := term.ReadPassword(0)
-		fmt.Println()
+	var passphraseMissingErr *ssh.PassphraseMissingError
+	if !errors.As(err, &passphraseMissingErr) {
+		return nil, &PrivateKeyError{Path: privateKeyPath, Err: err}
+	}
+
+	if passphrase != nil && *passphrase != "" {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(keyContent, []byte(*passphrase))
 		if err != nil {
-			return "", nil, err
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, &PrivateKeyError{Path: privateKeyPath, Err: ErrIncorrectPassphrase}
+			}
+			return nil, &PrivateKeyError{Path: privateKeyPath, Err: err}
+		}
+		return ssh.PublicKeys(signer), nil
+	}
+
+	signers, err := getAgentSigners(passphraseMissingErr.PublicKey)
+	if err != nil || len(signers) == 0 {
+		return nil, &PrivateKeyError{Path: privateKeyPath, Err: ErrPassphraseRequired}
+	}
+
+	return ssh.PublicKeys(signers...), nil
+}
+
+// getAgentSigners returns the signers of the ssh-agent, only the one for publicKey if it is known
+func getAgentSigners(publicKey ssh.PublicKey) ([]ssh.Signer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("SSH_AUTH_SOCK not set")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, err
+	}
+
+	signers := []ssh.Signer{}
+	for _, key := range keys {
+		if publicKey == nil || bytes.Equal(key.Marshal(), publicKey.Marshal()) {
+			signers = append(signers, &agentSigner{sock: sock, publicKey: key})
 		}
+	}
 
-		stringPassword := string(password)
+	return signers, nil
+}
 
-		return privateKeyPath, &stringPassword, nil
+// agentSigner signs with a key of the ssh-agent. It connects to the agent for each signature, so no connection
+// to the agent is left open by the auth methods using it.
+type agentSigner struct {
+	sock      string
+	publicKey ssh.PublicKey
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.publicKey
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *agentSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	conn, err := net.Dial("unix", s.sock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, signer := range signers {
+		if !bytes.Equal(signer.PublicKey().Marshal(), s.publicKey.Marshal()) {
+			continue
+		}
+
+		algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+		if algorithm == "" || !ok {
+			return signer.Sign(rand, data)
+		}
+		return algorithmSigner.SignWithAlgorithm(rand, data, algorithm)
 	}
 
-	return "", nil, err
+	return nil, errors.New("the key was removed from the ssh-agent")
 }
@@ -1,5 +1,47 @@
 package types
 
+import "encoding/json"
+
 type WorkspaceMetadata struct {
 	NetworkId string
+	Labels    map[string]string
+}
+
+// MarshalJSON flattens the workspace container labels into the metadata object
+// so that existing consumers can keep reading them as top level keys.
+func (m WorkspaceMetadata) MarshalJSON() ([]byte, error) {
+	metadata := map[string]string{}
+	for key, value := range m.Labels {
+		metadata[key] = value
+	}
+	metadata["NetworkId"] = m.NetworkId
+
+	return json.Marshal(metadata)
+}
+
+func (m *WorkspaceMetadata) UnmarshalJSON(data []byte) error {
+	var metadata map[string]string
+	err := json.Unmarshal(data, &metadata)
+	if err != nil {
+		return err
+	}
+
+	m.NetworkId = metadata["NetworkId"]
+	delete(metadata, "NetworkId")
+	m.Labels = metadata
+
+	return nil
+}
+
+type TargetMetadata struct {
+	DockerVersion     string
+	KvmAvailable      bool
+	TunAvailable      bool
+	Cpus              int
+	MemoryTotal       int64
+	DataDirFreeDisk   uint64
+	RunningWorkspaces int
+	StoppedWorkspaces int
+	ImageCached       bool
+	GoldenImages      []string
 }
@@ -2,7 +2,9 @@ package types
 
 import (
 	"encoding/json"
+	"net/url"
 
+	"github.com/daytonaio/daytona-provider-windows/pkg/docker_context"
 	"github.com/daytonaio/daytona/pkg/models"
 )
 
@@ -12,8 +14,25 @@ type TargetConfigOptions struct {
 	RemoteUser       *string `json:"Remote User,omitempty"`
 	RemotePassword   *string `json:"Remote Password,omitempty"`
 	RemotePrivateKey *string `json:"Remote Private Key Path,omitempty"`
+	RemotePassphrase *string `json:"Remote Private Key Passphrase,omitempty"`
 	SockPath         *string `json:"Sock Path,omitempty"`
 	TargetDataDir    *string `json:"Target Data Dir,omitempty"`
+	CpuCores         *int    `json:"CPU Cores,omitempty"`
+	RamSize          *string `json:"RAM Size,omitempty"`
+	DiskSize         *string `json:"Disk Size,omitempty"`
+	WindowsVersion   *string `json:"Windows Version,omitempty"`
+	GoldenImageCache *bool   `json:"Golden Image Cache,omitempty"`
+	BootTimeout      *int    `json:"Boot Timeout,omitempty"`
+	KnownHostsFile   *string `json:"Known Hosts File,omitempty"`
+	JumpHosts        *string `json:"Jump Hosts,omitempty"`
+	DockerHost       *string `json:"Docker Host,omitempty"`
+	TlsCaPath        *string `json:"TLS CA Path,omitempty"`
+	TlsCertPath      *string `json:"TLS Cert Path,omitempty"`
+	TlsKeyPath       *string `json:"TLS Key Path,omitempty"`
+	DockerContext    *string `json:"Docker Context,omitempty"`
+	AgentForwarding  *bool   `json:"Agent Forwarding,omitempty"`
+	ShutdownTimeout  *int    `json:"Shutdown Timeout,omitempty"`
+	SuspendOnStop    *bool   `json:"Suspend On Stop,omitempty"`
 }
 
 func GetTargetConfigManifest() *models.TargetConfigManifest {
@@ -43,6 +62,12 @@ func GetTargetConfigManifest() *models.TargetConfigManifest {
 			DefaultValue:      "~/.ssh",
 			DisabledPredicate: "^local-windows$",
 		},
+		"Remote Private Key Passphrase": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Passphrase of an encrypted private key. If empty, the key is used through the ssh-agent",
+			DisabledPredicate: "^local-windows$",
+			InputMasked:       true,
+		},
 		"Sock Path": models.TargetConfigProperty{
 			Type:         models.TargetConfigPropertyTypeString,
 			DefaultValue: "/var/run/docker.sock",
@@ -53,6 +78,100 @@ func GetTargetConfigManifest() *models.TargetConfigManifest {
 			Description:       "The directory on the remote host where the target data will be stored",
 			DisabledPredicate: "^local-windows$",
 		},
+		"CPU Cores": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "2",
+			Description:  "Number of CPU cores of the Windows VM. Can be overridden with the CPU_CORES workspace env var",
+		},
+		"RAM Size": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeString,
+			DefaultValue: "4G",
+			Description:  "Amount of RAM of the Windows VM, e.g. 16G. Can be overridden with the RAM_SIZE workspace env var",
+			Suggestions:  []string{"4G", "8G", "16G", "32G"},
+		},
+		"Disk Size": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeString,
+			DefaultValue: "64G",
+			Description:  "Size of the Windows VM disk, e.g. 128G. Can be overridden with the DISK_SIZE workspace env var",
+			Suggestions:  []string{"64G", "128G", "256G"},
+		},
+		"Windows Version": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: "11",
+			Description: "Windows edition installed in the VM: 11 (Pro), 11l (LTSC), 11e (Enterprise), 10 (Pro), 10l (LTSC), " +
+				"10e (Enterprise), 2025, 2022, 2019 or 2016 (Server)",
+			Options: []string{"11", "11l", "11e", "10", "10l", "10e", "2025", "2022", "2019", "2016"},
+		},
+		"Golden Image Cache": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeBoolean,
+			DefaultValue: "true",
+			Description: "Install Windows once per host and Windows version and create workspace disks as " +
+				"copy-on-write overlays of that install",
+		},
+		"Boot Timeout": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "60",
+			Description:  "Minutes to wait for a Windows VM to download, install and boot before failing",
+		},
+		"Known Hosts File": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeFilePath,
+			DefaultValue: "~/.ssh",
+			Description: "Optional known_hosts file used to verify the remote host key. " +
+				"Hosts not listed in it are trusted on first use and pinned by the provider",
+		},
+		"Jump Hosts": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "Optional comma separated list of SSH hops to reach the remote host through, " +
+				"e.g. user@bastion:22,user:password@inner:2222?identity=~/.ssh/id_inner. " +
+				"Hops without a password or identity use the ssh-agent and the default SSH keys",
+			DisabledPredicate: "^local-windows$",
+			// Hops can contain passwords
+			InputMasked: true,
+		},
+		"Docker Host": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "Optional Docker host URL, e.g. tcp://host:2376. When set, the Docker API is reached directly " +
+				"instead of forwarding the socket over SSH",
+			DisabledPredicate: "^local-windows$",
+		},
+		"TLS CA Path": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "CA certificate used to verify the Docker Host",
+			DisabledPredicate: "^local-windows$",
+		},
+		"TLS Cert Path": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "Client certificate used to authenticate to the Docker Host",
+			DisabledPredicate: "^local-windows$",
+		},
+		"TLS Key Path": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "Client key used to authenticate to the Docker Host",
+			DisabledPredicate: "^local-windows$",
+		},
+		"Docker Context": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "Optional name of a Docker CLI context (see docker context ls) to take the Docker Host " +
+				"and TLS certificates from. ssh:// endpoints are reached with the ssh binary like the Docker CLI does",
+			DisabledPredicate: "^local-windows$",
+		},
+		"Agent Forwarding": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeBoolean,
+			DefaultValue: "false",
+			Description: "Forward the ssh-agent of the provider (SSH_AUTH_SOCK) to git cloning the workspace " +
+				"repository into the Windows VM, e.g. over SSH. Keys are never copied into the VM",
+		},
+		"Shutdown Timeout": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "120",
+			Description:  "Seconds to wait for Windows to shut down when stopping a workspace before the container is stopped forcibly",
+		},
+		"Suspend On Stop": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeBoolean,
+			DefaultValue: "false",
+			Description: "Save the memory of the Windows VM to the workspace volume when stopping a workspace and restore it " +
+				"on start instead of shutting down and booting Windows. Falls back to a cold boot if the restore fails",
+		},
 	}
 }
 
@@ -63,5 +182,66 @@ func ParseTargetConfigOptions(optionsJson string) (opts *TargetConfigOptions, is
 		return nil, false, err
 	}
 
-	return &targetOptions, targetOptions.RemoteHostname == nil, nil
+	err = targetOptions.applyDockerContext()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &targetOptions, targetOptions.IsLocal(), nil
+}
+
+// IsLocal returns true if the Docker host is the machine the provider runs on
+func (o *TargetConfigOptions) IsLocal() bool {
+	return o.RemoteHostname == nil && o.GetDockerHostname() == nil
+}
+
+// GetHostname returns the hostname of a remote Docker host, used to reach the VMs it runs, or nil for local targets
+func (o *TargetConfigOptions) GetHostname() *string {
+	if o.RemoteHostname != nil {
+		return o.RemoteHostname
+	}
+
+	return o.GetDockerHostname()
+}
+
+// GetDockerHostname returns the hostname of the Docker Host URL if it points to a remote machine
+func (o *TargetConfigOptions) GetDockerHostname() *string {
+	if o.DockerHost == nil || *o.DockerHost == "" {
+		return nil
+	}
+
+	u, err := url.Parse(*o.DockerHost)
+	if err != nil || u.Scheme == "unix" || u.Scheme == "npipe" || u.Hostname() == "" {
+		return nil
+	}
+
+	hostname := u.Hostname()
+	return &hostname
+}
+
+// applyDockerContext fills the Docker Host and TLS options that aren't set explicitly from the Docker Context
+func (o *TargetConfigOptions) applyDockerContext() error {
+	if o.DockerContext == nil || *o.DockerContext == "" || *o.DockerContext == docker_context.DefaultContextName {
+		return nil
+	}
+
+	dockerContext, err := docker_context.Get(*o.DockerContext)
+	if err != nil {
+		return err
+	}
+
+	if o.DockerHost == nil || *o.DockerHost == "" {
+		o.DockerHost = &dockerContext.Host
+	}
+	if o.TlsCaPath == nil && dockerContext.TlsCaPath != "" {
+		o.TlsCaPath = &dockerContext.TlsCaPath
+	}
+	if o.TlsCertPath == nil && dockerContext.TlsCertPath != "" {
+		o.TlsCertPath = &dockerContext.TlsCertPath
+	}
+	if o.TlsKeyPath == nil && dockerContext.TlsKeyPath != "" {
+		o.TlsKeyPath = &dockerContext.TlsKeyPath
+	}
+
+	return nil
 }
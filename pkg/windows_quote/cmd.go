@@ -0,0 +1,133 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package windows_quote quotes strings for the command lines and scripts run in Windows VMs.
+//
+// Programs started by cmd.exe split their command line into arguments following the rules of
+// CommandLineToArgvW, while cmd.exe itself expands variables and interprets operators like & and | before.
+// Arguments are therefore quoted for the program first and then escaped for cmd.exe.
+package windows_quote
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedCharacter is returned for strings that can not be passed through cmd.exe, i.e. strings containing
+// line breaks, which end the command, or NUL characters, which end the command line.
+var ErrUnsupportedCharacter = errors.New("unsupported character")
+
+// cmdMetaCharacters are the characters cmd.exe interprets outside of quotes.
+const cmdMetaCharacters = "()%!^\"<>&|"
+
+// Arg quotes arg as a single argument of a command line split following the rules of CommandLineToArgvW.
+func Arg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\v\"") {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+
+	backslashes := 0
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			// Backslashes preceding a quote are escaped, as is the quote itself
+			b.WriteString(strings.Repeat("\\", 2*backslashes+1))
+		default:
+			b.WriteString(strings.Repeat("\\", backslashes))
+		}
+		backslashes = 0
+		b.WriteByte(c)
+	}
+
+	// Backslashes preceding the closing quote are escaped
+	b.WriteString(strings.Repeat("\\", 2*backslashes))
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// Cmd escapes every character of s interpreted by cmd.exe on a command line with a caret, including quotes,
+// so cmd.exe passes s on to the program as is.
+func Cmd(s string) (string, error) {
+	err := checkCmdCharacters(s)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(cmdMetaCharacters, c) {
+			b.WriteByte('^')
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String(), nil
+}
+
+// Batch escapes s like Cmd for a line of a batch file. A % is doubled instead, as carets do not escape it
+// in batch files.
+func Batch(s string) (string, error) {
+	err := checkCmdCharacters(s)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c == '%':
+			b.WriteByte('%')
+		case strings.ContainsRune(cmdMetaCharacters, c):
+			b.WriteByte('^')
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String(), nil
+}
+
+// CmdCommand returns a cmd.exe command line running program with args. The program is expected to be a trusted
+// name or path, the args can be arbitrary strings.
+func CmdCommand(program string, args ...string) (string, error) {
+	if program == "" || strings.ContainsAny(program, "\"%!") {
+		return "", fmt.Errorf("invalid program %q", program)
+	}
+	err := checkCmdCharacters(program)
+	if err != nil {
+		return "", err
+	}
+
+	// cmd /c strips the first and the last quote of command lines starting with a quote, the leading @ (which
+	// only turns off echoing) keeps a quoted program intact
+	cmd := program
+	if strings.ContainsAny(program, " \t"+cmdMetaCharacters) {
+		cmd = fmt.Sprintf("@\"%s\"", program)
+	}
+
+	for _, arg := range args {
+		escaped, err := Cmd(Arg(arg))
+		if err != nil {
+			return "", fmt.Errorf("invalid argument %q: %w", arg, err)
+		}
+		cmd += " " + escaped
+	}
+
+	return cmd, nil
+}
+
+func checkCmdCharacters(s string) error {
+	if i := strings.IndexAny(s, "\r\n\x00"); i >= 0 {
+		return fmt.Errorf("%w %q at position %d", ErrUnsupportedCharacter, s[i], i)
+	}
+
+	return nil
+}
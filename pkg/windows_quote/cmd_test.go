@@ -0,0 +1,261 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package windows_quote
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArg(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"plain", "abc", "abc"},
+		{"empty", "", `""`},
+		{"space", "a b", `"a b"`},
+		{"tab", "a\tb", "\"a\tb\""},
+		{"quote", `a"b`, `"a\"b"`},
+		{"backslashes before quote", `a\\"b`, `"a\\\\\"b"`},
+		{"backslashes not before quote", `C:\Program Files\x`, `"C:\Program Files\x"`},
+		{"trailing backslash", `C:\dir name\`, `"C:\dir name\\"`},
+		{"trailing backslashes", `a b\\`, `"a b\\\\"`},
+		{"unquoted trailing backslash", `C:\dir\`, `C:\dir\`},
+		{"cmd metacharacters", "a&b|c<d>e^f(g)h!i%VAR%", "a&b|c<d>e^f(g)h!i%VAR%"},
+		{"non-BMP", "😀 x", `"😀 x"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Arg(tt.arg)
+			if got != tt.want {
+				t.Errorf("Arg(%q) = %q, want %q", tt.arg, got, tt.want)
+			}
+
+			parsed := parseCommandLineArgs(got)
+			if len(parsed) != 1 || parsed[0] != tt.arg {
+				t.Errorf("Arg(%q) = %q is parsed as %q", tt.arg, got, parsed)
+			}
+		})
+	}
+}
+
+func TestCmd(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "abc", "abc", false},
+		{"operators", "a&b|c<d>e", "a^&b^|c^<d^>e", false},
+		{"caret", "a^b", "a^^b", false},
+		{"parentheses", "(a)", "^(a^)", false},
+		{"variables", "%PATH%!VAR!", "^%PATH^%^!VAR^!", false},
+		{"quotes", `"a b"`, `^"a b^"`, false},
+		{"non-BMP", "😀&", "😀^&", false},
+		{"newline", "a\nb", "", true},
+		{"carriage return", "a\rb", "", true},
+		{"NUL", "a\x00b", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Cmd(tt.s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedCharacter) {
+					t.Errorf("Cmd(%q) error = %v, want ErrUnsupportedCharacter", tt.s, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Cmd(%q) error = %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("Cmd(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "abc", "abc", false},
+		{"percent", "%PATH%", "%%PATH%%", false},
+		{"operators", "a&b|c", "a^&b^|c", false},
+		{"delayed expansion", "!VAR!", "^!VAR^!", false},
+		{"quotes and caret", `"^"`, `^"^^^"`, false},
+		{"newline", "a\r\nb", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Batch(tt.s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedCharacter) {
+					t.Errorf("Batch(%q) error = %v, want ErrUnsupportedCharacter", tt.s, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Batch(%q) error = %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("Batch(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCmdCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"no args", "whoami", nil, "whoami", false},
+		{"plain args", "net", []string{"user", "daytona"}, "net user daytona", false},
+		{"program with space", `C:\Program Files\Git\bin\git.exe`, []string{"status"}, `@"C:\Program Files\Git\bin\git.exe" status`, false},
+		{"program with metacharacter", `C:\a&b\x.exe`, nil, `@"C:\a&b\x.exe"`, false},
+		{"quote injection", "setx", []string{"K", `v"&whoami`}, `setx K ^"v\^"^&whoami^"`, false},
+		{"trailing backslash", "setx", []string{"K", `C:\a b\`}, `setx K ^"C:\a b\\^"`, false},
+		{"variable", "setx", []string{"K", "%PATH%"}, "setx K ^%PATH^%", false},
+		{"empty arg", "setx", []string{"K", ""}, `setx K ^"^"`, false},
+		{"newline in arg", "setx", []string{"K", "a\nb"}, "", true},
+		{"NUL in arg", "setx", []string{"K", "a\x00"}, "", true},
+		{"empty program", "", nil, "", true},
+		{"quote in program", `a"b`, nil, "", true},
+		{"variable in program", "%COMSPEC%", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CmdCommand(tt.program, tt.args...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("CmdCommand(%q, %q) = %q, want an error", tt.program, tt.args, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CmdCommand(%q, %q) error = %v", tt.program, tt.args, err)
+			}
+			if got != tt.want {
+				t.Errorf("CmdCommand(%q, %q) = %q, want %q", tt.program, tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCmdCommandRoundTrip checks that the program receives the arguments as they were passed after cmd.exe
+// processed the command line.
+func TestCmdCommandRoundTrip(t *testing.T) {
+	args := []string{
+		"",
+		" ",
+		"plain",
+		`a"b`,
+		`"`,
+		`\`,
+		`\\"`,
+		`C:\dir name\`,
+		`trailing\\`,
+		"a&b|c<d>e^f(g)h!i",
+		"%PATH% !VAR!",
+		"tab\there",
+		"’typographic‘ 'quotes'",
+		"😀 non-BMP 𝄞",
+	}
+
+	cmd, err := CmdCommand("program", args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commandLine := unescapeCmd(cmd)
+	parsed := parseCommandLineArgs(strings.TrimPrefix(commandLine, "program "))
+	if !reflect.DeepEqual(parsed, args) {
+		t.Errorf("CmdCommand(%q) = %q is parsed as %q", args, cmd, parsed)
+	}
+}
+
+// unescapeCmd removes the carets cmd.exe removes from a command line. Cmd escapes quotes as well, so the
+// command line never enters a quoted section for cmd.exe.
+func unescapeCmd(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '^' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// parseCommandLineArgs splits a command line into arguments like CommandLineToArgvW does for the arguments
+// following the program name.
+func parseCommandLineArgs(s string) []string {
+	args := []string{}
+	var arg strings.Builder
+	inArg, inQuotes := false, false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			backslashes := 0
+			for i < len(s) && s[i] == '\\' {
+				backslashes++
+				i++
+			}
+			if i < len(s) && s[i] == '"' {
+				arg.WriteString(strings.Repeat("\\", backslashes/2))
+				if backslashes%2 == 1 {
+					arg.WriteByte('"')
+				} else {
+					inQuotes = !inQuotes
+				}
+			} else {
+				arg.WriteString(strings.Repeat("\\", backslashes))
+				i--
+			}
+			inArg = true
+		case c == '"':
+			if inQuotes && i+1 < len(s) && s[i+1] == '"' {
+				arg.WriteByte('"')
+				i++
+			} else {
+				inQuotes = !inQuotes
+			}
+			inArg = true
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args
+}
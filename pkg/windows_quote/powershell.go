@@ -0,0 +1,48 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package windows_quote
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf16"
+)
+
+// powerShellSingleQuotes are the characters PowerShell accepts as single quotes, i.e. the apostrophe and
+// the typographic single quotation marks.
+const powerShellSingleQuotes = "'‘’‚‛"
+
+// PowerShell returns s as a single-quoted PowerShell string literal, in which PowerShell expands nothing.
+func PowerShell(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, c := range s {
+		// A quote in a single-quoted string is escaped by doubling it
+		if strings.ContainsRune(powerShellSingleQuotes, c) {
+			b.WriteRune(c)
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('\'')
+
+	return b.String()
+}
+
+// EncodePowerShell encodes script for the -EncodedCommand parameter of PowerShell, i.e. as base64 of its UTF-16LE
+// representation.
+func EncodePowerShell(script string) string {
+	encoded := make([]byte, 0, 2*len(script))
+	for _, c := range utf16.Encode([]rune(script)) {
+		encoded = append(encoded, byte(c), byte(c>>8))
+	}
+
+	return base64.StdEncoding.EncodeToString(encoded)
+}
+
+// PowerShellCommand returns a command line running script with PowerShell. The encoded script consists of
+// characters neither cmd.exe nor PowerShell interpret, so it can be passed through both. Command lines are
+// limited to 8191 characters by cmd.exe, longer scripts have to be passed on stdin.
+func PowerShellCommand(script string) string {
+	return "powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand " + EncodePowerShell(script)
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package windows_quote
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestPowerShell(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"plain", "abc", "'abc'"},
+		{"empty", "", "''"},
+		{"apostrophe", "it's", "'it''s'"},
+		{"typographic quotes", "‘a’ ‚b‛", "'‘‘a’’ ‚‚b‛‛'"},
+		{"variables and subexpressions", "$env:PATH $(whoami) `n", "'$env:PATH $(whoami) `n'"},
+		{"double quotes", `"a"`, `'"a"'`},
+		{"cmd metacharacters", "a&b|c<d>e^f(g)h!i%VAR%", "'a&b|c<d>e^f(g)h!i%VAR%'"},
+		{"newlines", "a\r\nb", "'a\r\nb'"},
+		{"non-BMP", "😀'", "'😀'''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PowerShell(tt.s)
+			if got != tt.want {
+				t.Errorf("PowerShell(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodePowerShell(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"ASCII", "A", "QQA="},
+		{"BMP", "Aé", "QQDpAA=="},
+		{"non-BMP surrogate pair", "Aé😀", "QQDpAD3YAN4="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EncodePowerShell(tt.script)
+			if got != tt.want {
+				t.Errorf("EncodePowerShell(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+
+			if decoded := decodePowerShell(t, got); decoded != tt.script {
+				t.Errorf("EncodePowerShell(%q) = %q decodes to %q", tt.script, got, decoded)
+			}
+		})
+	}
+}
+
+func TestPowerShellCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"plain", "Write-Output 'hello'"},
+		{"cmd metacharacters", "echo \"a&b|c\" > %TEMP%\\x ^ !y!"},
+		{"multiline", "$a = 1\r\nif ($a) {\n  'x'\n}"},
+		{"non-BMP", "'😀'"},
+	}
+
+	prefix := "powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand "
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PowerShellCommand(tt.script)
+			if !strings.HasPrefix(got, prefix) {
+				t.Fatalf("PowerShellCommand(%q) = %q, want prefix %q", tt.script, got, prefix)
+			}
+
+			encoded := strings.TrimPrefix(got, prefix)
+			if strings.ContainsAny(encoded, cmdMetaCharacters+" \t\r\n") {
+				t.Errorf("PowerShellCommand(%q) = %q contains characters interpreted by cmd.exe", tt.script, got)
+			}
+			if decoded := decodePowerShell(t, encoded); decoded != tt.script {
+				t.Errorf("PowerShellCommand(%q) = %q runs %q", tt.script, got, decoded)
+			}
+		})
+	}
+}
+
+func decodePowerShell(t *testing.T, encoded string) string {
+	t.Helper()
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid base64 %q: %v", encoded, err)
+	}
+	if len(decoded)%2 != 0 {
+		t.Fatalf("odd UTF-16LE length %d", len(decoded))
+	}
+
+	units := make([]uint16, len(decoded)/2)
+	for i := range units {
+		units[i] = uint16(decoded[2*i]) | uint16(decoded[2*i+1])<<8
+	}
+
+	return string(utf16.Decode(units))
+}